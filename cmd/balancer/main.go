@@ -2,12 +2,12 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"loadbalancer/internal/balancer"
 	"loadbalancer/internal/config"
 	"loadbalancer/internal/handler"
 	healthchecker "loadbalancer/internal/health_checker"
 	"loadbalancer/internal/lib/sl"
+	"loadbalancer/internal/lib/trustedproxy"
 	"loadbalancer/internal/proxy"
 	ratelimiter "loadbalancer/internal/rate_limiter"
 	"loadbalancer/internal/server"
@@ -29,12 +29,16 @@ func main() {
 	if err != nil {
 		panic("Failed to load configuration: " + err.Error())
 	}
-	fmt.Println(cfg)
 
 	log := setupLogger(cfg.Env)
 	log.Info("starting load balancer", slog.String("with config", *configPath))
 
-	lb := balancer.NewRoundRobinBalancer(log)
+	lb, err := balancer.New(cfg.Balancer, log)
+	if err != nil {
+		log.Error("balancer has not been created", sl.Err(err))
+		return
+	}
+	log.Info("balancer initialized", slog.String("algorithm", cfg.Balancer.Algorithm))
 
 	for _, backendCfg := range cfg.Backends {
 		backend, err := balancer.NewBackend(backendCfg)
@@ -42,6 +46,9 @@ func main() {
 			log.Error("failde to create backend", slog.String("backendURL", backendCfg.URL), sl.Err(err))
 			continue
 		}
+		if cfg.Breaker.Enabled {
+			backend.ConfigureCircuitBreaker(cfg.Breaker)
+		}
 		lb.AddBackend(*backend)
 	}
 
@@ -49,7 +56,31 @@ func main() {
 	healthChecker.Start()
 	defer healthChecker.Stop()
 
-	proxyHandler := proxy.NewReverseProxy(lb, log)
+	trustedProxies, err := trustedproxy.New(cfg.TrustedProxies)
+	if err != nil {
+		log.Error("invalid trusted proxies", sl.Err(err))
+		return
+	}
+
+	proxyOpts := []proxy.Option{
+		proxy.WithBackends(cfg.Backends),
+		proxy.WithTrustedProxies(trustedProxies),
+	}
+	if cfg.Breaker.Enabled {
+		proxyOpts = append(proxyOpts, proxy.WithCircuitBreaker())
+	}
+	if cfg.Outlier.Enabled {
+		outlierDetector := healthchecker.NewOutlierDetector(lb, log, cfg.Outlier)
+		outlierDetector.Start()
+		defer outlierDetector.Stop()
+		proxyOpts = append(proxyOpts, proxy.WithOutlierDetector(outlierDetector))
+	}
+
+	proxyHandler, err := proxy.NewReverseProxy(lb, cfg.Proxy, log, proxyOpts...)
+	if err != nil {
+		log.Error("proxy has not been created", sl.Err(err))
+		return
+	}
 
 	// только существующий файл
 	storage, err := storage.NewFileStorage(cfg.Storage.FilePath)
@@ -79,10 +110,13 @@ func main() {
 	if cfg.RateLimiter.Enabled {
 		headerIP = cfg.RateLimiter.HeaderIP
 	}
-	handler := handler.SetupHandlers(proxyHandler, rateLimiter, headerIP, log)
+	handler := handler.SetupHandlers(proxyHandler, rateLimiter, headerIP, trustedProxies, log)
 
 	srv := server.New(handler, &cfg.Server, log)
-	if err := srv.Start(); err != nil {
+	err = srv.Start()
+	// сервер не ждет захваченные соединения, туннели закрываются до выхода
+	proxyHandler.CloseTunnels()
+	if err != nil {
 		log.Error("server error", sl.Err(err))
 		os.Exit(1)
 	}
@@ -1,6 +1,6 @@
 module loadbalancer
 
-go 1.23.1
+go 1.24
 
 require (
 	github.com/stretchr/testify v1.10.0
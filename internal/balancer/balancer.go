@@ -1,32 +1,185 @@
 package balancer
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/proxyproto"
+	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ProtocolHTTP1 = "http1"
+	// HTTP/2 поверх TLS
+	ProtocolH2 = "h2"
+	// HTTP/2 без TLS
+	ProtocolH2C = "h2c"
+)
+
+var (
+	ErrUnknownProtocol      = errors.New("unknown backend protocol")
+	ErrUnknownProxyProtocol = errors.New("unknown proxy protocol version")
+	ErrProxyProtocolHTTP2   = errors.New("proxy protocol requires http1 backend")
 )
 
 type Backend struct {
 	URL    *url.URL
-	isDown bool
-	mu     sync.RWMutex
+	Weight int
+	// уровень приоритета, 0 - самый приоритетный
+	Priority int
+	// протокол соединений с бэкендом
+	Protocol string
+	// версия PROXY заголовка, который отправляется бэкенду, пусто - не отправляется
+	ProxyProtocol string
+	// TLS соединений с бэкендом, nil - настройки по умолчанию
+	TLSConfig *tls.Config
+	isDown    bool
+	mu        sync.RWMutex
+	// кол-во запросов, которые сейчас обрабатываются бэкендом
+	activeConns atomic.Int64
+	// среднее время ответа бэкенда
+	latency ewma
+	// момент добавления или восстановления бэкенда, от него отсчитывается slow start
+	recoveredAt time.Time
+	// до этого момента бэкенд исключен из балансировки outlier detection
+	ejectedUntil time.Time
+	breaker      CircuitBreaker
 }
 
+// Бэкенд недоступен, если не прошел активную проверку здоровья,
+// исключен outlier detection, его circuit breaker в состоянии open
+// или в half-open заняты все слоты пробных запросов
 func (b *Backend) IsDown() bool {
+	if !b.breaker.Available() {
+		return true
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.isDown || time.Now().Before(b.ejectedUntil)
+}
+
+// Результат только активных проверок здоровья, без учета исключения outlier detection
+func (b *Backend) IsHealthy() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return !b.isDown
+}
+
+// Исключает бэкенд из балансировки до момента until,
+// после чего он возвращается автоматически
+func (b *Backend) Eject(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ejectedUntil = until
+}
+
+func (b *Backend) IsEjected() bool {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	return b.isDown
+	return time.Now().Before(b.ejectedUntil)
 }
 
 // true == isDown
 func (b *Backend) SetHealth(healthy bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	if b.isDown && !healthy {
+		b.recoveredAt = time.Now()
+	}
 	b.isDown = healthy
 }
 
+// Настраивает circuit breaker бэкенда
+func (b *Backend) ConfigureCircuitBreaker(cfg config.CircuitBreaker) {
+	b.breaker.configure(cfg)
+}
+
+func (b *Backend) CircuitState() CircuitState {
+	return b.breaker.State()
+}
+
+// Проверяет circuit breaker перед отправкой запроса на бэкенд.
+// Результат разрешенного запроса нужно передать в ReportSuccess, ReportFailure
+// или ReportCanceled
+func (b *Backend) AllowRequest() bool {
+	return b.breaker.Allow()
+}
+
+func (b *Backend) ReportSuccess() {
+	b.breaker.Success()
+}
+
+// Учитывает неудачный запрос, возвращает true если circuit breaker перешел в open
+func (b *Backend) ReportFailure() bool {
+	return b.breaker.Failure()
+}
+
+// Запрос к бэкенду отменен, результат не учитывается
+func (b *Backend) ReportCanceled() {
+	b.breaker.Cancel()
+}
+
+// Переводит circuit breaker бэкенда в open, бэкенд исключается
+// из балансировки до истечения cooldown
+func (b *Backend) TripCircuit() {
+	b.breaker.Trip()
+}
+
+// Увеличивает счетчик запросов в обработке, вызывается при отправке запроса на бэкенд
+func (b *Backend) IncConnections() {
+	b.activeConns.Add(1)
+}
+
+// Уменьшает счетчик запросов в обработке, вызывается после закрытия тела ответа
+func (b *Backend) DecConnections() {
+	b.activeConns.Add(-1)
+}
+
+func (b *Backend) ActiveConnections() int64 {
+	return b.activeConns.Load()
+}
+
+// Учитывает время ответа бэкенда в скользящем среднем
+func (b *Backend) ObserveLatency(d time.Duration) {
+	b.latency.observe(d, time.Now())
+}
+
+// Учитывает ошибку бэкенда (ошибку соединения или 5xx) штрафным временем ответа
+func (b *Backend) ObserveFailure() {
+	b.latency.observeFailure(time.Now())
+}
+
+// Возвращает среднее время ответа бэкенда, 0 если замеров еще не было
+func (b *Backend) Latency() time.Duration {
+	return b.latency.get()
+}
+
+// Набор протоколов для http.Transport по имени протокола бэкенда
+func HTTPProtocols(protocol string) (*http.Protocols, error) {
+	protocols := &http.Protocols{}
+	switch protocol {
+	case ProtocolHTTP1, "":
+		protocols.SetHTTP1(true)
+	case ProtocolH2:
+		protocols.SetHTTP2(true)
+	case ProtocolH2C:
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProtocol, protocol)
+	}
+	return protocols, nil
+}
+
 type Balancer interface {
-	Next() (*Backend, error)
+	// r используется стратегиями, которые выбирают бэкенд по атрибутам запроса,
+	// остальные стратегии его игнорируют (может быть nil)
+	Next(r *http.Request) (*Backend, error)
 	MarkAsDown(backend *Backend)
 	AddBackend(backend Backend)
 	RemoveBackend(url string) bool
@@ -38,8 +191,41 @@ func NewBackend(config config.Backend) (*Backend, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// вес по умолчанию 1, чтобы бэкенды без веса получали равную долю трафика
+	weight := config.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+
+	protocol := config.Protocol
+	if protocol == "" {
+		protocol = ProtocolHTTP1
+	}
+	if _, err := HTTPProtocols(protocol); err != nil {
+		return nil, err
+	}
+	if !proxyproto.ValidVersion(config.ProxyProtocol) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProxyProtocol, config.ProxyProtocol)
+	}
+	// соединение HTTP/2 мультиплексирует запросы разных клиентов,
+	// а PROXY заголовок передает адрес одного клиента на все соединение
+	if config.ProxyProtocol != "" && protocol != ProtocolHTTP1 {
+		return nil, ErrProxyProtocolHTTP2
+	}
+	tlsConfig, err := TLSClientConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Backend{
-		URL:    backUrl,
-		isDown: false,
+		URL:           backUrl,
+		Weight:        weight,
+		Priority:      config.Priority,
+		Protocol:      protocol,
+		ProxyProtocol: config.ProxyProtocol,
+		TLSConfig:     tlsConfig,
+		isDown:        false,
+		recoveredAt:   time.Now(),
 	}, nil
 }
@@ -0,0 +1,265 @@
+package balancer
+
+import (
+	"loadbalancer/internal/config"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	// запросы проходят, ошибки подсчитываются
+	CircuitClosed CircuitState = iota
+	// бэкенд исключен, запросы сразу отклоняются до истечения cooldown
+	CircuitOpen
+	// после cooldown пропускается ограниченное кол-во пробных запросов
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	defaultBreakerConsecutiveFailures = 5
+	defaultBreakerMinRequests         = 20
+	defaultBreakerInterval            = 10 * time.Second
+	defaultBreakerCooldown            = 30 * time.Second
+	defaultBreakerHalfOpenRequests    = 1
+)
+
+// Circuit breaker бэкенда: closed -> open после серии ошибок или превышения
+// доли ошибок, open -> half-open после cooldown, half-open -> closed после
+// успешных пробных запросов или обратно в open при первой ошибке.
+// Нулевое значение готово к использованию: подсчет ошибок выключен,
+// но бэкенд можно перевести в open через Trip
+type CircuitBreaker struct {
+	cfg   config.CircuitBreaker
+	state CircuitState
+
+	openedAt time.Time
+	// момент перехода из half-open в closed, от него отсчитывается slow start
+	closedAt time.Time
+	// начало текущего интервала подсчета запросов в состоянии closed
+	intervalStart       time.Time
+	requests            int
+	failures            int
+	consecutiveFailures int
+
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+
+	mu sync.Mutex
+}
+
+func (cb *CircuitBreaker) configure(cfg config.CircuitBreaker) {
+	if cfg.ConsecutiveFailures == 0 {
+		cfg.ConsecutiveFailures = defaultBreakerConsecutiveFailures
+	}
+	if cfg.MinRequests == 0 {
+		cfg.MinRequests = defaultBreakerMinRequests
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultBreakerInterval
+	}
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = defaultBreakerCooldown
+	}
+	if cfg.HalfOpenRequests == 0 {
+		cfg.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.cfg = cfg
+}
+
+// Текущее состояние. Open с истекшим cooldown считается half-open
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.refreshState(time.Now())
+	return cb.state
+}
+
+// Бэкенд может принять запрос: breaker не в open и в half-open есть свободный
+// слот пробного запроса. В отличие от Allow слот не занимается
+func (cb *CircuitBreaker) Available() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.refreshState(time.Now())
+
+	switch cb.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return cb.halfOpenInFlight < cb.halfOpenRequests()
+	}
+	return true
+}
+
+// Проверяет, можно ли отправить запрос на бэкенд.
+// В half-open занимает слот пробного запроса, который освобождается
+// вызовом Success, Failure или Cancel
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.refreshState(time.Now())
+
+	switch cb.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if cb.halfOpenInFlight >= cb.halfOpenRequests() {
+			return false
+		}
+		cb.halfOpenInFlight++
+	}
+	return true
+}
+
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	cb.refreshState(now)
+
+	switch cb.state {
+	case CircuitClosed:
+		cb.consecutiveFailures = 0
+		cb.count(now, false)
+	case CircuitHalfOpen:
+		cb.releaseProbe()
+		cb.halfOpenSuccesses++
+		if cb.halfOpenSuccesses >= cb.halfOpenRequests() {
+			cb.setState(CircuitClosed, now)
+		}
+	}
+}
+
+// Учитывает ошибку, возвращает true если breaker перешел в open
+func (cb *CircuitBreaker) Failure() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	cb.refreshState(now)
+
+	switch cb.state {
+	case CircuitClosed:
+		if !cb.cfg.Enabled {
+			return false
+		}
+		cb.consecutiveFailures++
+		cb.count(now, true)
+
+		if cb.consecutiveFailures >= cb.cfg.ConsecutiveFailures ||
+			(cb.cfg.ErrorRatio > 0 &&
+				cb.requests >= cb.cfg.MinRequests &&
+				float64(cb.failures)/float64(cb.requests) >= cb.cfg.ErrorRatio) {
+			cb.setState(CircuitOpen, now)
+			return true
+		}
+	case CircuitHalfOpen:
+		cb.releaseProbe()
+		cb.setState(CircuitOpen, now)
+		return true
+	}
+	return false
+}
+
+// Запрос отменен до получения результата: слот пробного запроса
+// освобождается, ошибка не учитывается
+func (cb *CircuitBreaker) Cancel() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.releaseProbe()
+	}
+}
+
+// Принудительно переводит breaker в open
+func (cb *CircuitBreaker) Trip() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.setState(CircuitOpen, time.Now())
+}
+
+// Вызывается под блокировкой cb.mu
+func (cb *CircuitBreaker) refreshState(now time.Time) {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.cooldown() {
+		cb.setState(CircuitHalfOpen, now)
+	}
+}
+
+// Момент последнего восстановления бэкенда после half-open, нулевое время если его не было
+func (cb *CircuitBreaker) ClosedAt() time.Time {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.closedAt
+}
+
+// Вызывается под блокировкой cb.mu
+func (cb *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	if cb.state == CircuitHalfOpen && state == CircuitClosed {
+		cb.closedAt = now
+	}
+	cb.state = state
+	cb.requests = 0
+	cb.failures = 0
+	cb.consecutiveFailures = 0
+	cb.intervalStart = now
+	cb.halfOpenInFlight = 0
+	cb.halfOpenSuccesses = 0
+
+	if state == CircuitOpen {
+		cb.openedAt = now
+	}
+}
+
+// Вызывается под блокировкой cb.mu
+func (cb *CircuitBreaker) count(now time.Time, failure bool) {
+	if now.Sub(cb.intervalStart) >= cb.cfg.Interval {
+		cb.intervalStart = now
+		cb.requests = 0
+		cb.failures = 0
+	}
+
+	cb.requests++
+	if failure {
+		cb.failures++
+	}
+}
+
+func (cb *CircuitBreaker) releaseProbe() {
+	if cb.halfOpenInFlight > 0 {
+		cb.halfOpenInFlight--
+	}
+}
+
+func (cb *CircuitBreaker) cooldown() time.Duration {
+	if cb.cfg.Cooldown == 0 {
+		return defaultBreakerCooldown
+	}
+	return cb.cfg.Cooldown
+}
+
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	if cb.cfg.HalfOpenRequests == 0 {
+		return defaultBreakerHalfOpenRequests
+	}
+	return cb.cfg.HalfOpenRequests
+}
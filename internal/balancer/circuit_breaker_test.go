@@ -0,0 +1,182 @@
+package balancer
+
+import (
+	"fmt"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	newBreaker := func(cfg config.CircuitBreaker) *CircuitBreaker {
+		cfg.Enabled = true
+		cb := &CircuitBreaker{}
+		cb.configure(cfg)
+		return cb
+	}
+
+	t.Run("Zero value is closed and ignores failures", func(t *testing.T) {
+		var cb CircuitBreaker
+		assert.Equal(t, CircuitClosed, cb.State())
+
+		for i := 0; i < 10; i++ {
+			assert.False(t, cb.Failure())
+		}
+		assert.True(t, cb.Allow())
+
+		cb.Trip()
+		assert.Equal(t, CircuitOpen, cb.State())
+		assert.False(t, cb.Allow())
+	})
+
+	t.Run("Open after consecutive failures", func(t *testing.T) {
+		cb := newBreaker(config.CircuitBreaker{ConsecutiveFailures: 3})
+
+		cb.Failure()
+		cb.Failure()
+		cb.Success()
+		cb.Failure()
+		cb.Failure()
+		assert.Equal(t, CircuitClosed, cb.State())
+
+		assert.True(t, cb.Failure())
+		assert.Equal(t, CircuitOpen, cb.State())
+		assert.False(t, cb.Allow())
+	})
+
+	t.Run("Open after error ratio", func(t *testing.T) {
+		cb := newBreaker(config.CircuitBreaker{
+			ConsecutiveFailures: 100,
+			ErrorRatio:          0.5,
+			MinRequests:         4,
+		})
+
+		cb.Success()
+		cb.Failure()
+		cb.Success()
+		assert.Equal(t, CircuitClosed, cb.State())
+
+		assert.True(t, cb.Failure())
+		assert.Equal(t, CircuitOpen, cb.State())
+	})
+
+	t.Run("Half-open probes", func(t *testing.T) {
+		cb := newBreaker(config.CircuitBreaker{
+			ConsecutiveFailures: 1,
+			Cooldown:            20 * time.Millisecond,
+			HalfOpenRequests:    2,
+		})
+
+		cb.Failure()
+		assert.Equal(t, CircuitOpen, cb.State())
+
+		time.Sleep(30 * time.Millisecond)
+		assert.Equal(t, CircuitHalfOpen, cb.State())
+
+		assert.True(t, cb.Allow())
+		assert.True(t, cb.Allow())
+		assert.False(t, cb.Allow())
+
+		cb.Success()
+		assert.Equal(t, CircuitHalfOpen, cb.State())
+		cb.Success()
+		assert.Equal(t, CircuitClosed, cb.State())
+	})
+
+	t.Run("Failed probe reopens", func(t *testing.T) {
+		cb := newBreaker(config.CircuitBreaker{
+			ConsecutiveFailures: 1,
+			Cooldown:            20 * time.Millisecond,
+		})
+
+		cb.Failure()
+		time.Sleep(30 * time.Millisecond)
+
+		assert.True(t, cb.Allow())
+		assert.True(t, cb.Failure())
+		assert.Equal(t, CircuitOpen, cb.State())
+	})
+
+	t.Run("Cancelled probe frees its slot", func(t *testing.T) {
+		cb := newBreaker(config.CircuitBreaker{
+			ConsecutiveFailures: 1,
+			Cooldown:            20 * time.Millisecond,
+		})
+
+		cb.Failure()
+		time.Sleep(30 * time.Millisecond)
+
+		assert.True(t, cb.Allow())
+		assert.False(t, cb.Allow())
+		cb.Cancel()
+		assert.Equal(t, CircuitHalfOpen, cb.State())
+		assert.True(t, cb.Allow())
+	})
+
+	t.Run("Open breaker marks backend as down", func(t *testing.T) {
+		backend := &Backend{}
+		backend.ConfigureCircuitBreaker(config.CircuitBreaker{Enabled: true, ConsecutiveFailures: 1})
+		assert.False(t, backend.IsDown())
+
+		backend.ReportFailure()
+		assert.True(t, backend.IsDown())
+		assert.Equal(t, CircuitOpen, backend.CircuitState())
+	})
+
+	t.Run("Closed breaker starts slow start", func(t *testing.T) {
+		backend := &Backend{Weight: 4, recoveredAt: time.Now().Add(-time.Hour)}
+		backend.ConfigureCircuitBreaker(config.CircuitBreaker{
+			Enabled:             true,
+			ConsecutiveFailures: 1,
+			Cooldown:            20 * time.Millisecond,
+		})
+		assert.Equal(t, 4.0, backend.EffectiveWeight(time.Minute))
+
+		backend.ReportFailure()
+		time.Sleep(30 * time.Millisecond)
+		assert.True(t, backend.AllowRequest())
+		backend.ReportSuccess()
+		assert.Equal(t, CircuitClosed, backend.CircuitState())
+
+		assert.InDelta(t, 0.4, backend.EffectiveWeight(time.Minute), 0.1)
+	})
+
+	t.Run("Busy half-open backend is skipped", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+		ch := NewConsistentHashBalancer(config.HashBalancer{Key: HashKeyHeader, KeyName: "X-User-ID"}, logger)
+		for i := range 3 {
+			backend, err := NewBackend(config.Backend{URL: fmt.Sprintf("http://server%d.com", i)})
+			require.NoError(t, err)
+			ch.AddBackend(*backend)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User-ID", "user-42")
+		first, err := ch.Next(req)
+		require.NoError(t, err)
+
+		first.ConfigureCircuitBreaker(config.CircuitBreaker{Enabled: true, Cooldown: 20 * time.Millisecond})
+		first.TripCircuit()
+		time.Sleep(30 * time.Millisecond)
+		assert.False(t, first.IsDown())
+
+		// пробный запрос занял единственный слот, остальные идут на другой бэкенд
+		require.True(t, first.AllowRequest())
+		assert.True(t, first.IsDown())
+		next, err := ch.Next(req)
+		require.NoError(t, err)
+		assert.NotSame(t, first, next)
+
+		first.ReportSuccess()
+		next, err = ch.Next(req)
+		require.NoError(t, err)
+		assert.Same(t, first, next)
+	})
+}
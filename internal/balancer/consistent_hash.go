@@ -0,0 +1,238 @@
+package balancer
+
+import (
+	"hash/crc32"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/clientcert"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	HashKeyIP     = "ip"
+	HashKeyHeader = "header"
+	HashKeyCookie = "cookie"
+	HashKeyPath   = "path"
+	// subject проверенного сертификата клиента
+	HashKeyClientCert = "client_cert"
+
+	defaultHashReplicas = 100
+	defaultLoadFactor   = 1.25
+)
+
+type ringNode struct {
+	hash    uint32
+	backend *Backend
+}
+
+// Consistent hashing на кольце с виртуальными узлами.
+// Запросы с одинаковым ключом (ip клиента, заголовок, cookie или путь) попадают
+// на один и тот же бэкенд, а при добавлении или удалении бэкенда
+// переезжает только ~1/N ключей.
+// При loadFactor > 1 работает в режиме bounded loads: бэкенд, у которого
+// запросов в обработке больше loadFactor * среднее, пропускается
+type ConsistentHashBalancer struct {
+	backends   []*Backend
+	ring       []ringNode
+	key        string
+	keyName    string
+	replicas   int
+	loadFactor float64
+	opts       options
+	mu         sync.RWMutex
+	log        *slog.Logger
+}
+
+func NewConsistentHashBalancer(cfg config.HashBalancer, log *slog.Logger, opts ...Option) *ConsistentHashBalancer {
+	if cfg.Key == "" {
+		cfg.Key = HashKeyIP
+	}
+	if cfg.Replicas <= 0 {
+		cfg.Replicas = defaultHashReplicas
+	}
+	// при loadFactor <= 1 предел нагрузки не выше средней, и ключи перестают
+	// находить свой бэкенд, поэтому используется значение по умолчанию
+	if cfg.LoadFactor != 0 && cfg.LoadFactor <= 1 {
+		log.Warn("load factor must be greater than 1, using default",
+			slog.Float64("load_factor", cfg.LoadFactor),
+			slog.Float64("default", defaultLoadFactor),
+		)
+		cfg.LoadFactor = defaultLoadFactor
+	}
+
+	return &ConsistentHashBalancer{
+		backends:   make([]*Backend, 0),
+		key:        cfg.Key,
+		keyName:    cfg.KeyName,
+		replicas:   cfg.Replicas,
+		loadFactor: cfg.LoadFactor,
+		opts:       newOptions(opts),
+		log:        log,
+	}
+}
+
+// Ищет на кольце первый узел после хэша ключа и идет по часовой стрелке,
+// пропуская недоступные бэкенды
+func (ch *ConsistentHashBalancer) Next(r *http.Request) (*Backend, error) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	if len(ch.ring) == 0 {
+		return nil, ErrNoAvailableBackends
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(ch.hashKey(r)))
+	start := sort.Search(len(ch.ring), func(i int) bool {
+		return ch.ring[i].hash >= hash
+	})
+
+	priority, ok := activePriority(ch.backends, ch.opts.priorityThreshold)
+	if !ok {
+		return nil, ErrNoAvailableBackends
+	}
+
+	capacity := ch.loadCapacity(priority)
+
+	var fallback *Backend
+	for i := 0; i < len(ch.ring); i++ {
+		node := ch.ring[(start+i)%len(ch.ring)]
+		if node.backend.IsDown() || node.backend.Priority != priority {
+			continue
+		}
+		if capacity == 0 || node.backend.ActiveConnections() < capacity {
+			return node.backend, nil
+		}
+		if fallback == nil {
+			fallback = node.backend
+		}
+	}
+
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, ErrNoAvailableBackends
+}
+
+// Максимальное кол-во запросов в обработке на бэкенд в режиме bounded loads:
+// ceil(loadFactor * (запросов в обработке + 1) / доступных бэкендов уровня priority).
+// 0 означает, что ограничение выключено
+func (ch *ConsistentHashBalancer) loadCapacity(priority int) int64 {
+	if ch.loadFactor <= 0 {
+		return 0
+	}
+
+	var total int64
+	available := 0
+	for _, backend := range ch.backends {
+		if backend.IsDown() || backend.Priority != priority {
+			continue
+		}
+		total += backend.ActiveConnections()
+		available++
+	}
+
+	if available == 0 {
+		return 0
+	}
+	return int64(math.Ceil(ch.loadFactor * float64(total+1) / float64(available)))
+}
+
+// Возвращает ключ запроса в зависимости от настроенного источника.
+// Если заголовка, cookie или сертификата клиента нет, используется ip клиента
+func (ch *ConsistentHashBalancer) hashKey(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	switch ch.key {
+	case HashKeyHeader:
+		if value := r.Header.Get(ch.keyName); value != "" {
+			return value
+		}
+	case HashKeyCookie:
+		if cookie, err := r.Cookie(ch.keyName); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	case HashKeyPath:
+		return r.URL.Path
+	case HashKeyClientCert:
+		if subject, ok := clientcert.Subject(r); ok {
+			return subject
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// Перестраивает кольцо, вызывается под блокировкой ch.mu
+func (ch *ConsistentHashBalancer) rebuildRing() {
+	ring := make([]ringNode, 0, len(ch.backends)*ch.replicas)
+	for _, backend := range ch.backends {
+		id := backend.URL.String()
+		for i := 0; i < ch.replicas; i++ {
+			ring = append(ring, ringNode{
+				hash:    crc32.ChecksumIEEE([]byte(id + "#" + strconv.Itoa(i))),
+				backend: backend,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	ch.ring = ring
+}
+
+func (ch *ConsistentHashBalancer) MarkAsDown(backend *Backend) {
+	if backend == nil {
+		return
+	}
+
+	backend.TripCircuit()
+	ch.log.Error("backend marked as down", slog.String("url", backend.URL.String()))
+}
+
+// Добавляет новый бэкенд в список бэкендов, распределяемых балансировщиком
+func (ch *ConsistentHashBalancer) AddBackend(backend Backend) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	backendCopy := backend
+	ch.backends = append(ch.backends, &backendCopy)
+	ch.rebuildRing()
+	ch.log.Info("backend added", slog.String("url", backend.URL.String()))
+}
+
+func (ch *ConsistentHashBalancer) RemoveBackend(url string) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for index, backend := range ch.backends {
+		if backend.URL.String() == url {
+			ch.backends = append(ch.backends[:index], ch.backends[index+1:]...)
+			ch.rebuildRing()
+			ch.log.Info("backend removed", slog.String("url", url))
+			return true
+		}
+	}
+	return false
+}
+
+func (ch *ConsistentHashBalancer) GetAllBackends() []*Backend {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	backendsCopy := make([]*Backend, len(ch.backends))
+	copy(backendsCopy, ch.backends)
+
+	return backendsCopy
+}
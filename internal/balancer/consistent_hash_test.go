@@ -0,0 +1,161 @@
+package balancer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsistentHashBalancer(t *testing.T) {
+	createBackend := func(u string, down bool) *Backend {
+		parsedURL, _ := url.Parse(u)
+		return &Backend{
+			URL:    parsedURL,
+			isDown: down,
+		}
+	}
+
+	requestWithHeader := func(value string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User-ID", value)
+		return r
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+	cfg := config.HashBalancer{Key: HashKeyHeader, KeyName: "X-User-ID"}
+
+	t.Run("No backends available", func(t *testing.T) {
+		ch := NewConsistentHashBalancer(cfg, logger)
+		_, err := ch.Next(requestWithHeader("user"))
+		assert.ErrorIs(t, err, ErrNoAvailableBackends)
+	})
+
+	t.Run("Same key goes to same backend", func(t *testing.T) {
+		ch := NewConsistentHashBalancer(cfg, logger)
+		for i := 0; i < 5; i++ {
+			ch.AddBackend(*createBackend(fmt.Sprintf("http://server%d.com", i), false))
+		}
+
+		first, err := ch.Next(requestWithHeader("user-42"))
+		assert.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			b, _ := ch.Next(requestWithHeader("user-42"))
+			assert.Equal(t, first.URL.String(), b.URL.String())
+		}
+	})
+
+	t.Run("Only a fraction of keys move on add", func(t *testing.T) {
+		ch := NewConsistentHashBalancer(cfg, logger)
+		for i := 0; i < 4; i++ {
+			ch.AddBackend(*createBackend(fmt.Sprintf("http://server%d.com", i), false))
+		}
+
+		const keys = 2000
+		before := make([]string, keys)
+		for i := range keys {
+			b, _ := ch.Next(requestWithHeader(fmt.Sprintf("user-%d", i)))
+			before[i] = b.URL.String()
+		}
+
+		ch.AddBackend(*createBackend("http://server4.com", false))
+
+		moved := 0
+		for i := range keys {
+			b, _ := ch.Next(requestWithHeader(fmt.Sprintf("user-%d", i)))
+			if b.URL.String() != before[i] {
+				assert.Equal(t, "http://server4.com", b.URL.String())
+				moved++
+			}
+		}
+
+		// в идеале переезжает 1/5 ключей
+		assert.Greater(t, moved, keys/10)
+		assert.Less(t, moved, keys*3/10)
+	})
+
+	t.Run("Skip down backends", func(t *testing.T) {
+		ch := NewConsistentHashBalancer(cfg, logger)
+		ch.AddBackend(*createBackend("http://server1.com", false))
+		ch.AddBackend(*createBackend("http://server2.com", false))
+
+		first, _ := ch.Next(requestWithHeader("user-1"))
+		first.SetHealth(true)
+
+		b, err := ch.Next(requestWithHeader("user-1"))
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.URL.String(), b.URL.String())
+	})
+
+	t.Run("Bounded loads spill over to next backend", func(t *testing.T) {
+		boundedCfg := cfg
+		boundedCfg.LoadFactor = 1.25
+		ch := NewConsistentHashBalancer(boundedCfg, logger)
+		ch.AddBackend(*createBackend("http://server1.com", false))
+		ch.AddBackend(*createBackend("http://server2.com", false))
+
+		hot, _ := ch.Next(requestWithHeader("hot-tenant"))
+		for i := 0; i < 4; i++ {
+			hot.IncConnections()
+		}
+
+		// средняя нагрузка (4+1)/2, предел ceil(1.25*2.5) = 4
+		b, err := ch.Next(requestWithHeader("hot-tenant"))
+		assert.NoError(t, err)
+		assert.NotEqual(t, hot.URL.String(), b.URL.String())
+
+		// нагрузка 1, предел ceil(1.25*2/2) = 2
+		hot.DecConnections()
+		hot.DecConnections()
+		hot.DecConnections()
+		b, _ = ch.Next(requestWithHeader("hot-tenant"))
+		assert.Equal(t, hot.URL.String(), b.URL.String())
+	})
+
+	t.Run("Load factor not above 1 falls back to default", func(t *testing.T) {
+		for _, factor := range []float64{-1, 0.5, 1} {
+			boundedCfg := cfg
+			boundedCfg.LoadFactor = factor
+			assert.Equal(t, defaultLoadFactor, NewConsistentHashBalancer(boundedCfg, logger).loadFactor)
+		}
+		assert.Zero(t, NewConsistentHashBalancer(cfg, logger).loadFactor)
+	})
+
+	t.Run("Fallback to client ip", func(t *testing.T) {
+		ch := NewConsistentHashBalancer(cfg, logger)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		assert.Equal(t, "10.0.0.1", ch.hashKey(r))
+	})
+
+	t.Run("Client certificate subject", func(t *testing.T) {
+		ch := NewConsistentHashBalancer(config.HashBalancer{Key: HashKeyClientCert}, logger)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		assert.Equal(t, "10.0.0.1", ch.hashKey(r))
+
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "orders", Organization: []string{"shop"}}},
+		}}}
+		assert.Equal(t, "CN=orders,O=shop", ch.hashKey(r))
+	})
+
+	t.Run("Add and Remove backends", func(t *testing.T) {
+		ch := NewConsistentHashBalancer(cfg, logger)
+		ch.AddBackend(*createBackend("http://server1.com", false))
+		assert.Len(t, ch.GetAllBackends(), 1)
+
+		assert.True(t, ch.RemoveBackend("http://server1.com"))
+		assert.Len(t, ch.GetAllBackends(), 0)
+		assert.False(t, ch.RemoveBackend("http://invalid.com"))
+	})
+}
@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// время, за которое вклад старого значения в среднее уменьшается в e раз
+	defaultEWMADecay = 10 * time.Second
+	// ошибка учитывается как ответ во столько раз медленнее среднего
+	failurePenaltyFactor = 4
+	// минимальное время ответа, которым учитывается ошибка
+	minFailurePenalty = time.Second
+)
+
+// Экспоненциально затухающее среднее времени ответа бэкенда.
+// Вес предыдущего значения зависит от времени, прошедшего с последнего замера,
+// поэтому редкие замеры не "застревают" в среднем надолго
+type ewma struct {
+	value      float64
+	lastUpdate time.Time
+	decay      time.Duration
+	mu         sync.Mutex
+}
+
+func (e *ewma) observe(sample time.Duration, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	decay := e.decay
+	if decay <= 0 {
+		decay = defaultEWMADecay
+	}
+
+	if e.lastUpdate.IsZero() {
+		e.value = float64(sample)
+		e.lastUpdate = now
+		return
+	}
+
+	elapsed := now.Sub(e.lastUpdate)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	w := math.Exp(-float64(elapsed) / float64(decay))
+
+	e.value = e.value*w + float64(sample)*(1-w)
+	e.lastUpdate = now
+}
+
+// Учитывает ошибку как медленный ответ, чтобы бэкенд, который быстро
+// отвечает ошибками, не получал больше трафика
+func (e *ewma) observeFailure(now time.Time) {
+	e.observe(max(e.get()*failurePenaltyFactor, minFailurePenalty), now)
+}
+
+func (e *ewma) get() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.value)
+}
@@ -0,0 +1,107 @@
+package balancer
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// Выбирает бэкенд с наименьшим кол-вом запросов в обработке на единицу веса
+// (вес учитывает slow start).
+// При равенстве кандидаты перебираются по кругу, чтобы нагрузка не ложилась
+// всегда на первый бэкенд из списка
+type LeastConnectionsBalancer struct {
+	backends []*Backend
+	current  int
+	opts     options
+	mu       sync.Mutex
+	log      *slog.Logger
+}
+
+func NewLeastConnectionsBalancer(log *slog.Logger, opts ...Option) *LeastConnectionsBalancer {
+	return &LeastConnectionsBalancer{
+		backends: make([]*Backend, 0),
+		current:  0,
+		opts:     newOptions(opts),
+		log:      log,
+	}
+}
+
+func (lc *LeastConnectionsBalancer) Next(r *http.Request) (*Backend, error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	priority, ok := activePriority(lc.backends, lc.opts.priorityThreshold)
+	if !ok {
+		return nil, ErrNoAvailableBackends
+	}
+
+	var candidates []*Backend
+	var minLoad float64
+
+	for _, backend := range lc.backends {
+		if backend.IsDown() || backend.Priority != priority {
+			continue
+		}
+
+		load := float64(backend.ActiveConnections()) / backend.EffectiveWeight(lc.opts.slowStart)
+		switch {
+		case len(candidates) == 0 || load < minLoad:
+			minLoad = load
+			candidates = append(candidates[:0], backend)
+		case load == minLoad:
+			candidates = append(candidates, backend)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoAvailableBackends
+	}
+
+	backend := candidates[lc.current%len(candidates)]
+	lc.current++
+	return backend, nil
+}
+
+func (lc *LeastConnectionsBalancer) MarkAsDown(backend *Backend) {
+	if backend == nil {
+		return
+	}
+
+	backend.TripCircuit()
+	lc.log.Error("backend marked as down", slog.String("url", backend.URL.String()))
+}
+
+// Добавляет новый бэкенд в список бэкендов, распределяемых балансировщиком
+func (lc *LeastConnectionsBalancer) AddBackend(backend Backend) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	backendCopy := backend
+	lc.backends = append(lc.backends, &backendCopy)
+	lc.log.Info("backend added", slog.String("url", backend.URL.String()))
+}
+
+func (lc *LeastConnectionsBalancer) RemoveBackend(url string) bool {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	for index, backend := range lc.backends {
+		if backend.URL.String() == url {
+			lc.backends = append(lc.backends[:index], lc.backends[index+1:]...)
+			lc.log.Info("backend removed", slog.String("url", url))
+			return true
+		}
+	}
+	return false
+}
+
+func (lc *LeastConnectionsBalancer) GetAllBackends() []*Backend {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	backendsCopy := make([]*Backend, len(lc.backends))
+	copy(backendsCopy, lc.backends)
+
+	return backendsCopy
+}
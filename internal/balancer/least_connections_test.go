@@ -0,0 +1,89 @@
+package balancer
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeastConnectionsBalancer(t *testing.T) {
+	createBackend := func(u string, down bool) *Backend {
+		parsedURL, _ := url.Parse(u)
+		return &Backend{
+			URL:    parsedURL,
+			isDown: down,
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	t.Run("No backends available", func(t *testing.T) {
+		lc := NewLeastConnectionsBalancer(logger)
+		_, err := lc.Next(nil)
+		assert.ErrorIs(t, err, ErrNoAvailableBackends)
+	})
+
+	t.Run("All backends down", func(t *testing.T) {
+		lc := NewLeastConnectionsBalancer(logger)
+		lc.AddBackend(*createBackend("http://server1.com", true))
+
+		_, err := lc.Next(nil)
+		assert.ErrorIs(t, err, ErrNoAvailableBackends)
+	})
+
+	t.Run("Pick backend with fewest connections", func(t *testing.T) {
+		lc := NewLeastConnectionsBalancer(logger)
+		lc.AddBackend(*createBackend("http://server1.com", false))
+		lc.AddBackend(*createBackend("http://server2.com", false))
+		lc.AddBackend(*createBackend("http://server3.com", false))
+
+		backends := lc.GetAllBackends()
+		backends[0].IncConnections()
+		backends[0].IncConnections()
+		backends[2].IncConnections()
+
+		b, err := lc.Next(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://server2.com", b.URL.String())
+	})
+
+	t.Run("Ties are rotated", func(t *testing.T) {
+		lc := NewLeastConnectionsBalancer(logger)
+		lc.AddBackend(*createBackend("http://server1.com", false))
+		lc.AddBackend(*createBackend("http://server2.com", false))
+
+		b1, _ := lc.Next(nil)
+		b2, _ := lc.Next(nil)
+		assert.NotEqual(t, b1.URL.String(), b2.URL.String())
+	})
+
+	t.Run("Connections are released", func(t *testing.T) {
+		lc := NewLeastConnectionsBalancer(logger)
+		lc.AddBackend(*createBackend("http://server1.com", false))
+		lc.AddBackend(*createBackend("http://server2.com", false))
+
+		b1, _ := lc.Next(nil)
+		b1.IncConnections()
+
+		b2, _ := lc.Next(nil)
+		assert.NotEqual(t, b1.URL.String(), b2.URL.String())
+
+		b1.DecConnections()
+		assert.Equal(t, int64(0), b1.ActiveConnections())
+	})
+
+	t.Run("Skip down backends", func(t *testing.T) {
+		lc := NewLeastConnectionsBalancer(logger)
+		lc.AddBackend(*createBackend("http://server1.com", true))
+		lc.AddBackend(*createBackend("http://server2.com", false))
+
+		lc.GetAllBackends()[1].IncConnections()
+
+		b, err := lc.Next(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://server2.com", b.URL.String())
+	})
+}
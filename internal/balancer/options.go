@@ -0,0 +1,46 @@
+package balancer
+
+import (
+	"loadbalancer/internal/config"
+	"time"
+)
+
+// Общие настройки стратегий балансировки
+type options struct {
+	slowStart         time.Duration
+	priorityThreshold float64
+}
+
+type Option func(*options)
+
+// Время, за которое вес добавленного или восстановленного бэкенда
+// линейно дорастает до полного. Учитывается взвешенными стратегиями
+func WithSlowStart(window time.Duration) Option {
+	return func(o *options) {
+		o.slowStart = window
+	}
+}
+
+// Минимальная доля доступных бэкендов в уровне приоритета, при которой
+// трафик не уходит на менее приоритетные уровни
+func WithPriorityThreshold(threshold float64) Option {
+	return func(o *options) {
+		o.priorityThreshold = threshold
+	}
+}
+
+// Общие настройки из конфига, используются фабриками стратегий
+func OptionsFromConfig(cfg config.Balancer) []Option {
+	return []Option{
+		WithSlowStart(cfg.SlowStart),
+		WithPriorityThreshold(cfg.PriorityThreshold),
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
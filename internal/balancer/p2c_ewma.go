@@ -0,0 +1,117 @@
+package balancer
+
+import (
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Power of two choices: из доступных бэкендов случайно выбираются два,
+// и запрос уходит на тот, у которого меньше оценка нагрузки.
+// Оценка учитывает среднее время ответа и кол-во запросов в обработке,
+// поэтому медленные бэкенды сами теряют трафик
+type P2CEWMABalancer struct {
+	backends []*Backend
+	opts     options
+	mu       sync.Mutex
+	rand     *rand.Rand
+	log      *slog.Logger
+}
+
+func NewP2CEWMABalancer(log *slog.Logger, opts ...Option) *P2CEWMABalancer {
+	return &P2CEWMABalancer{
+		backends: make([]*Backend, 0),
+		opts:     newOptions(opts),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		log:      log,
+	}
+}
+
+func (p *P2CEWMABalancer) Next(r *http.Request) (*Backend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	priority, ok := activePriority(p.backends, p.opts.priorityThreshold)
+	if !ok {
+		return nil, ErrNoAvailableBackends
+	}
+
+	available := make([]*Backend, 0, len(p.backends))
+	for _, backend := range p.backends {
+		if !backend.IsDown() && backend.Priority == priority {
+			available = append(available, backend)
+		}
+	}
+
+	switch len(available) {
+	case 0:
+		return nil, ErrNoAvailableBackends
+	case 1:
+		return available[0], nil
+	}
+
+	i := p.rand.Intn(len(available))
+	j := p.rand.Intn(len(available) - 1)
+	if j >= i {
+		j++
+	}
+
+	first, second := available[i], available[j]
+	if p2cScore(second, p.opts.slowStart) < p2cScore(first, p.opts.slowStart) {
+		return second, nil
+	}
+	return first, nil
+}
+
+// Оценка нагрузки бэкенда: среднее время ответа, умноженное на кол-во запросов
+// в обработке (+1 для текущего) и деленное на вес с учетом slow start.
+// Пока замеров нет, учитываются только запросы
+func p2cScore(backend *Backend, slowStart time.Duration) float64 {
+	latency := float64(backend.Latency()) + float64(time.Millisecond)
+	return latency * float64(backend.ActiveConnections()+1) / backend.EffectiveWeight(slowStart)
+}
+
+func (p *P2CEWMABalancer) MarkAsDown(backend *Backend) {
+	if backend == nil {
+		return
+	}
+
+	backend.TripCircuit()
+	p.log.Error("backend marked as down", slog.String("url", backend.URL.String()))
+}
+
+// Добавляет новый бэкенд в список бэкендов, распределяемых балансировщиком
+func (p *P2CEWMABalancer) AddBackend(backend Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backendCopy := backend
+	p.backends = append(p.backends, &backendCopy)
+	p.log.Info("backend added", slog.String("url", backend.URL.String()))
+}
+
+func (p *P2CEWMABalancer) RemoveBackend(url string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for index, backend := range p.backends {
+		if backend.URL.String() == url {
+			p.backends = append(p.backends[:index], p.backends[index+1:]...)
+			p.log.Info("backend removed", slog.String("url", url))
+			return true
+		}
+	}
+	return false
+}
+
+func (p *P2CEWMABalancer) GetAllBackends() []*Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backendsCopy := make([]*Backend, len(p.backends))
+	copy(backendsCopy, p.backends)
+
+	return backendsCopy
+}
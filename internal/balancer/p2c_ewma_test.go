@@ -0,0 +1,109 @@
+package balancer
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestP2CEWMABalancer(t *testing.T) {
+	createBackend := func(u string, down bool) *Backend {
+		parsedURL, _ := url.Parse(u)
+		return &Backend{
+			URL:    parsedURL,
+			isDown: down,
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	t.Run("No backends available", func(t *testing.T) {
+		p := NewP2CEWMABalancer(logger)
+		_, err := p.Next(nil)
+		assert.ErrorIs(t, err, ErrNoAvailableBackends)
+	})
+
+	t.Run("Single available backend", func(t *testing.T) {
+		p := NewP2CEWMABalancer(logger)
+		p.AddBackend(*createBackend("http://server1.com", true))
+		p.AddBackend(*createBackend("http://server2.com", false))
+
+		b, err := p.Next(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://server2.com", b.URL.String())
+	})
+
+	t.Run("Prefer faster backend", func(t *testing.T) {
+		p := NewP2CEWMABalancer(logger)
+		p.AddBackend(*createBackend("http://slow.com", false))
+		p.AddBackend(*createBackend("http://fast.com", false))
+
+		backends := p.GetAllBackends()
+		backends[0].ObserveLatency(500 * time.Millisecond)
+		backends[1].ObserveLatency(10 * time.Millisecond)
+
+		for i := 0; i < 10; i++ {
+			b, err := p.Next(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "http://fast.com", b.URL.String())
+		}
+	})
+
+	t.Run("Prefer less loaded backend", func(t *testing.T) {
+		p := NewP2CEWMABalancer(logger)
+		p.AddBackend(*createBackend("http://busy.com", false))
+		p.AddBackend(*createBackend("http://idle.com", false))
+
+		backends := p.GetAllBackends()
+		for i := 0; i < 5; i++ {
+			backends[0].IncConnections()
+		}
+
+		b, err := p.Next(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://idle.com", b.URL.String())
+	})
+
+	t.Run("Failing backend is penalized", func(t *testing.T) {
+		p := NewP2CEWMABalancer(logger)
+		p.AddBackend(*createBackend("http://failing.com", false))
+		p.AddBackend(*createBackend("http://healthy.com", false))
+
+		backends := p.GetAllBackends()
+		// ошибки приходят быстрее успешных ответов здорового бэкенда
+		backends[0].latency.observe(time.Millisecond, time.Now().Add(-10*time.Second))
+		backends[0].ObserveFailure()
+		backends[1].ObserveLatency(50 * time.Millisecond)
+
+		for i := 0; i < 10; i++ {
+			b, err := p.Next(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "http://healthy.com", b.URL.String())
+		}
+	})
+
+	t.Run("Failure penalty", func(t *testing.T) {
+		var e ewma
+		now := time.Now()
+		e.observeFailure(now)
+		assert.Equal(t, minFailurePenalty, e.get())
+
+		e.observe(2*time.Second, now.Add(time.Hour))
+		e.observeFailure(now.Add(2 * time.Hour))
+		assert.InDelta(t, float64(8*time.Second), float64(e.get()), float64(time.Millisecond))
+	})
+
+	t.Run("EWMA decays towards new samples", func(t *testing.T) {
+		var e ewma
+		now := time.Now()
+		e.observe(100*time.Millisecond, now)
+		assert.Equal(t, 100*time.Millisecond, e.get())
+
+		e.observe(10*time.Millisecond, now.Add(time.Minute))
+		assert.InDelta(t, float64(10*time.Millisecond), float64(e.get()), float64(time.Millisecond))
+	})
+}
@@ -0,0 +1,37 @@
+package balancer
+
+import "sort"
+
+// Выбирает уровень приоритета, из которого балансировщик берет бэкенды.
+// Меньшее значение Priority - более приоритетный уровень. Уровень подходит,
+// если в нем есть доступные бэкенды и их доля не меньше threshold.
+// Если ни один уровень не набирает порог, используется самый приоритетный
+// уровень, в котором есть хотя бы один доступный бэкенд.
+// false означает, что доступных бэкендов нет
+func activePriority(backends []*Backend, threshold float64) (int, bool) {
+	total := make(map[int]int)
+	available := make(map[int]int)
+	for _, backend := range backends {
+		total[backend.Priority]++
+		if !backend.IsDown() {
+			available[backend.Priority]++
+		}
+	}
+
+	if len(available) == 0 {
+		return 0, false
+	}
+
+	priorities := make([]int, 0, len(available))
+	for priority := range available {
+		priorities = append(priorities, priority)
+	}
+	sort.Ints(priorities)
+
+	for _, priority := range priorities {
+		if float64(available[priority])/float64(total[priority]) >= threshold {
+			return priority, true
+		}
+	}
+	return priorities[0], true
+}
@@ -1,65 +1,70 @@
 package balancer
 
 import (
-	"errors"
 	"math/rand"
+	"net/http"
 	"sync"
 	"time"
 )
 
 type RandomBalancer struct {
 	backends []*Backend
+	opts     options
 	mu       sync.RWMutex
 	rand     *rand.Rand
 }
 
-func NewRandomBalancer() *RandomBalancer {
+func NewRandomBalancer(opts ...Option) *RandomBalancer {
 	return &RandomBalancer{
 		backends: make([]*Backend, 0),
+		opts:     newOptions(opts),
 		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
-func (rb *RandomBalancer) Next() (*Backend, error) {
-	rb.mu.RLock()
-	defer rb.mu.RUnlock()
+func (rb *RandomBalancer) Next(r *http.Request) (*Backend, error) {
+	// rand.Rand не потокобезопасен, поэтому нужна эксклюзивная блокировка
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	priority, ok := activePriority(rb.backends, rb.opts.priorityThreshold)
+	if !ok {
+		return nil, ErrNoAvailableBackends
+	}
 
 	available := make([]*Backend, 0, len(rb.backends))
 	for _, b := range rb.backends {
-		b.mu.RLock()
-		if !b.isDown {
+		if !b.IsDown() && b.Priority == priority {
 			available = append(available, b)
 		}
-		b.mu.RUnlock()
 	}
-
+	// бэкенд мог упасть после выбора приоритета
 	if len(available) == 0 {
-		return nil, errors.New("no available backends")
+		return nil, ErrNoAvailableBackends
 	}
 
 	return available[rb.rand.Intn(len(available))], nil
 }
 
 func (rb *RandomBalancer) MarkAsDown(backend *Backend) {
-	backend.mu.Lock()
-	defer backend.mu.Unlock()
-	backend.isDown = true
+	if backend == nil {
+		return
+	}
+	backend.TripCircuit()
 }
 
 func (rb *RandomBalancer) AddBackend(backend Backend) {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
 
-	newBackend := &Backend{
-		isDown: backend.isDown,
-	}
+	newBackend := backend
 
 	if backend.URL != nil {
 		copyURL := *backend.URL
 		newBackend.URL = &copyURL
 	}
 
-	rb.backends = append(rb.backends, newBackend)
+	rb.backends = append(rb.backends, &newBackend)
 }
 
 func (rb *RandomBalancer) RemoveBackend(urlStr string) bool {
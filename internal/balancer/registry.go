@@ -0,0 +1,90 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	AlgorithmRoundRobin         = "round_robin"
+	AlgorithmWeightedRoundRobin = "weighted_round_robin"
+	AlgorithmRandom             = "random"
+	AlgorithmLeastConnections   = "least_connections"
+	AlgorithmP2CEWMA            = "p2c_ewma"
+	AlgorithmConsistentHash     = "consistent_hash"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown balancing algorithm")
+)
+
+// Создает балансировщик по настройкам из конфига
+type Factory func(cfg config.Balancer, log *slog.Logger) Balancer
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		AlgorithmRoundRobin: func(cfg config.Balancer, log *slog.Logger) Balancer {
+			return NewRoundRobinBalancer(log, OptionsFromConfig(cfg)...)
+		},
+		AlgorithmWeightedRoundRobin: func(cfg config.Balancer, log *slog.Logger) Balancer {
+			return NewWeightedRoundRobinBalancer(log, OptionsFromConfig(cfg)...)
+		},
+		AlgorithmRandom: func(cfg config.Balancer, log *slog.Logger) Balancer {
+			return NewRandomBalancer(OptionsFromConfig(cfg)...)
+		},
+		AlgorithmLeastConnections: func(cfg config.Balancer, log *slog.Logger) Balancer {
+			return NewLeastConnectionsBalancer(log, OptionsFromConfig(cfg)...)
+		},
+		AlgorithmP2CEWMA: func(cfg config.Balancer, log *slog.Logger) Balancer {
+			return NewP2CEWMABalancer(log, OptionsFromConfig(cfg)...)
+		},
+		AlgorithmConsistentHash: func(cfg config.Balancer, log *slog.Logger) Balancer {
+			return NewConsistentHashBalancer(cfg.Hash, log, OptionsFromConfig(cfg)...)
+		},
+	}
+)
+
+// Регистрирует стратегию балансировки под именем name,
+// существующая стратегия с тем же именем заменяется
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Возвращает имена всех зарегистрированных стратегий
+func Algorithms() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Создает балансировщик по имени алгоритма из cfg.Algorithm,
+// если алгоритм не указан используется round_robin
+func New(cfg config.Balancer, log *slog.Logger) (Balancer, error) {
+	name := cfg.Algorithm
+	if name == "" {
+		name = AlgorithmRoundRobin
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (available: %s)", ErrUnknownAlgorithm, name, strings.Join(Algorithms(), ", "))
+	}
+	return factory(cfg, log), nil
+}
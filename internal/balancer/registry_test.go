@@ -0,0 +1,54 @@
+package balancer
+
+import (
+	"loadbalancer/internal/config"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	t.Run("Default algorithm", func(t *testing.T) {
+		lb, err := New(config.Balancer{}, logger)
+		require.NoError(t, err)
+		assert.IsType(t, &RoundRobinBalancer{}, lb)
+	})
+
+	t.Run("Build by name", func(t *testing.T) {
+		lb, err := New(config.Balancer{Algorithm: AlgorithmRandom}, logger)
+		require.NoError(t, err)
+		assert.IsType(t, &RandomBalancer{}, lb)
+
+		lb, err = New(config.Balancer{Algorithm: AlgorithmConsistentHash}, logger)
+		require.NoError(t, err)
+		assert.IsType(t, &ConsistentHashBalancer{}, lb)
+	})
+
+	t.Run("Unknown algorithm", func(t *testing.T) {
+		_, err := New(config.Balancer{Algorithm: "fastest"}, logger)
+		assert.ErrorIs(t, err, ErrUnknownAlgorithm)
+		assert.Contains(t, err.Error(), AlgorithmRoundRobin)
+	})
+
+	t.Run("Register custom algorithm", func(t *testing.T) {
+		Register("custom", func(cfg config.Balancer, log *slog.Logger) Balancer {
+			return NewLeastConnectionsBalancer(log)
+		})
+		// реестр общий для пакета, стратегия не должна остаться для других тестов
+		t.Cleanup(func() {
+			registryMu.Lock()
+			defer registryMu.Unlock()
+			delete(registry, "custom")
+		})
+
+		assert.Contains(t, Algorithms(), "custom")
+		lb, err := New(config.Balancer{Algorithm: "custom"}, logger)
+		require.NoError(t, err)
+		assert.IsType(t, &LeastConnectionsBalancer{}, lb)
+	})
+}
@@ -3,6 +3,7 @@ package balancer
 import (
 	"errors"
 	"log/slog"
+	"net/http"
 	"sync"
 )
 
@@ -13,20 +14,22 @@ var (
 type RoundRobinBalancer struct {
 	backends []*Backend
 	current  int
+	opts     options
 	mu       sync.Mutex
 	log      *slog.Logger
 }
 
-func NewRoundRobinBalancer(log *slog.Logger) *RoundRobinBalancer {
+func NewRoundRobinBalancer(log *slog.Logger, opts ...Option) *RoundRobinBalancer {
 	return &RoundRobinBalancer{
 		backends: make([]*Backend, 0),
 		current:  0,
+		opts:     newOptions(opts),
 		log:      log,
 	}
 }
 
 // Возвращает следующий доступный бэкенд из списка бэкендов(rr.backends)
-func (rr *RoundRobinBalancer) Next() (*Backend, error) {
+func (rr *RoundRobinBalancer) Next(r *http.Request) (*Backend, error) {
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
 
@@ -37,14 +40,8 @@ func (rr *RoundRobinBalancer) Next() (*Backend, error) {
 
 	// rr.checkDownBackends()
 
-	availableCount := 0
-	for _, backend := range rr.backends {
-		if !backend.IsDown() {
-			availableCount++
-		}
-	}
-
-	if availableCount == 0 {
+	priority, ok := activePriority(rr.backends, rr.opts.priorityThreshold)
+	if !ok {
 		return nil, ErrNoAvailableBackends
 	}
 
@@ -53,7 +50,7 @@ func (rr *RoundRobinBalancer) Next() (*Backend, error) {
 		index := (startIndex + i) % backendCount
 		backend := rr.backends[index]
 
-		if !backend.IsDown() {
+		if !backend.IsDown() && backend.Priority == priority {
 			rr.current = (index + 1) % backendCount
 			return backend, nil
 		}
@@ -66,8 +63,9 @@ func (rr *RoundRobinBalancer) MarkAsDown(backend *Backend) {
 		return
 	}
 
-	//TODO: можно ставить пометку isDown после нескольких неудачных запросов
-	backend.SetHealth(true)
+	// бэкенд исключается до истечения cooldown circuit breaker,
+	// после чего получает пробные запросы
+	backend.TripCircuit()
 	rr.log.Error("backend marked as down", slog.String("url", backend.URL.String()))
 }
 
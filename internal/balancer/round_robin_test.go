@@ -24,7 +24,7 @@ func TestRoundRobinBalancer(t *testing.T) {
 
 	t.Run("No backends available", func(t *testing.T) {
 		rr := NewRoundRobinBalancer(logger)
-		_, err := rr.Next()
+		_, err := rr.Next(nil)
 		assert.ErrorIs(t, err, ErrNoAvailableBackends)
 	})
 
@@ -33,7 +33,7 @@ func TestRoundRobinBalancer(t *testing.T) {
 		rr.AddBackend(*createBackend("http://server1.com", true))
 		rr.AddBackend(*createBackend("http://server2.com", true))
 
-		_, err := rr.Next()
+		_, err := rr.Next(nil)
 		assert.ErrorIs(t, err, ErrNoAvailableBackends)
 	})
 
@@ -47,16 +47,16 @@ func TestRoundRobinBalancer(t *testing.T) {
 		rr.AddBackend(*server2)
 		rr.AddBackend(*server3)
 
-		b1, _ := rr.Next()
+		b1, _ := rr.Next(nil)
 		assert.Equal(t, server1.URL, b1.URL)
 
-		b2, _ := rr.Next()
+		b2, _ := rr.Next(nil)
 		assert.Equal(t, server2.URL, b2.URL)
 
-		b3, _ := rr.Next()
+		b3, _ := rr.Next(nil)
 		assert.Equal(t, server3.URL, b3.URL)
 
-		b4, _ := rr.Next()
+		b4, _ := rr.Next(nil)
 		assert.Equal(t, server1.URL, b4.URL)
 	})
 
@@ -70,13 +70,13 @@ func TestRoundRobinBalancer(t *testing.T) {
 		rr.AddBackend(*server2)
 		rr.AddBackend(*server3)
 
-		b1, _ := rr.Next()
+		b1, _ := rr.Next(nil)
 		assert.Equal(t, server1.URL, b1.URL)
 
-		b2, _ := rr.Next()
+		b2, _ := rr.Next(nil)
 		assert.Equal(t, server3.URL, b2.URL)
 
-		b3, _ := rr.Next()
+		b3, _ := rr.Next(nil)
 		assert.Equal(t, server1.URL, b3.URL)
 	})
 
@@ -139,7 +139,7 @@ func TestRoundRobinBalancer(t *testing.T) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				_, _ = rr.Next()
+				_, _ = rr.Next(nil)
 			}()
 		}
 
@@ -155,6 +155,54 @@ func TestRoundRobinBalancer(t *testing.T) {
 		wg.Wait()
 	})
 
+	t.Run("Priority failover", func(t *testing.T) {
+		rr := NewRoundRobinBalancer(logger, WithPriorityThreshold(0.5))
+		primary1 := createBackend("http://primary1.com", false)
+		primary2 := createBackend("http://primary2.com", false)
+		backup := createBackend("http://backup.com", false)
+		backup.Priority = 1
+
+		rr.AddBackend(*primary1)
+		rr.AddBackend(*primary2)
+		rr.AddBackend(*backup)
+		backends := rr.GetAllBackends()
+
+		for i := 0; i < 4; i++ {
+			b, err := rr.Next(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, b.Priority)
+		}
+
+		// половина основного уровня доступна - порог еще не пройден
+		backends[0].SetHealth(true)
+		b, _ := rr.Next(nil)
+		assert.Equal(t, primary2.URL, b.URL)
+
+		backends[1].SetHealth(true)
+		b, err := rr.Next(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, backup.URL, b.URL)
+	})
+
+	t.Run("Priority below threshold everywhere", func(t *testing.T) {
+		rr := NewRoundRobinBalancer(logger, WithPriorityThreshold(1))
+		primary := createBackend("http://primary1.com", false)
+		down := createBackend("http://primary2.com", true)
+		backup1 := createBackend("http://backup1.com", false)
+		backup1.Priority = 1
+		backup2 := createBackend("http://backup2.com", true)
+		backup2.Priority = 1
+
+		rr.AddBackend(*primary)
+		rr.AddBackend(*down)
+		rr.AddBackend(*backup1)
+		rr.AddBackend(*backup2)
+
+		b, err := rr.Next(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, primary.URL, b.URL)
+	})
+
 	t.Run("SetHealth check", func(t *testing.T) {
 		rr := NewRoundRobinBalancer(logger)
 		server := createBackend("http://server1.com", true)
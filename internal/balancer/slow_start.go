@@ -0,0 +1,47 @@
+package balancer
+
+import "time"
+
+// доля веса, с которой бэкенд начинает slow start
+const slowStartMinFactor = 0.1
+
+// Возвращает вес бэкенда с учетом slow start: после добавления, восстановления,
+// возвращения после исключения или закрытия circuit breaker вес линейно растет
+// от 10% до полного за время window.
+// При window <= 0 slow start выключен и возвращается полный вес
+func (b *Backend) EffectiveWeight(window time.Duration) float64 {
+	weight := float64(b.Weight)
+	if weight <= 0 {
+		weight = 1
+	}
+
+	if window <= 0 {
+		return weight
+	}
+
+	b.mu.RLock()
+	recoveredAt := b.recoveredAt
+	if b.ejectedUntil.After(recoveredAt) && !time.Now().Before(b.ejectedUntil) {
+		recoveredAt = b.ejectedUntil
+	}
+	b.mu.RUnlock()
+	// бэкенд, исключенный circuit breaker, восстанавливается через half-open
+	if closedAt := b.breaker.ClosedAt(); closedAt.After(recoveredAt) {
+		recoveredAt = closedAt
+	}
+
+	if recoveredAt.IsZero() {
+		return weight
+	}
+
+	elapsed := time.Since(recoveredAt)
+	if elapsed >= window {
+		return weight
+	}
+
+	factor := float64(elapsed) / float64(window)
+	if factor < slowStartMinFactor {
+		factor = slowStartMinFactor
+	}
+	return weight * factor
+}
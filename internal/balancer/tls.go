@@ -0,0 +1,53 @@
+package balancer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"loadbalancer/internal/config"
+	"os"
+)
+
+var (
+	ErrInvalidCA         = errors.New("no certificates found in ca file")
+	ErrClientCertPartial = errors.New("cert_file and key_file must be set together")
+)
+
+// TLS клиента для соединений с бэкендом: свой CA, клиентский сертификат (mTLS)
+// и имя сервера для проверки. Возвращает nil, если настройки не заданы
+func TLSClientConfig(cfg config.BackendTLS) (*tls.Config, error) {
+	if cfg == (config.BackendTLS{}) {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCA, cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, ErrClientCertPartial
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,119 @@
+package balancer
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+type weightedBackend struct {
+	backend       *Backend
+	currentWeight float64
+}
+
+// Плавный взвешенный round-robin (smooth weighted round-robin как в nginx):
+// трафик распределяется пропорционально весам, но без серий запросов подряд
+// на один и тот же бэкенд. Вес учитывает slow start
+type WeightedRoundRobinBalancer struct {
+	backends []*weightedBackend
+	opts     options
+	mu       sync.Mutex
+	log      *slog.Logger
+}
+
+func NewWeightedRoundRobinBalancer(log *slog.Logger, opts ...Option) *WeightedRoundRobinBalancer {
+	return &WeightedRoundRobinBalancer{
+		backends: make([]*weightedBackend, 0),
+		opts:     newOptions(opts),
+		log:      log,
+	}
+}
+
+// На каждом шаге текущий вес каждого доступного бэкенда увеличивается на его вес,
+// выбирается бэкенд с наибольшим текущим весом, и его текущий вес уменьшается
+// на сумму весов всех доступных бэкендов
+func (wrr *WeightedRoundRobinBalancer) Next(r *http.Request) (*Backend, error) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	all := make([]*Backend, len(wrr.backends))
+	for i, wb := range wrr.backends {
+		all[i] = wb.backend
+	}
+
+	priority, ok := activePriority(all, wrr.opts.priorityThreshold)
+	if !ok {
+		return nil, ErrNoAvailableBackends
+	}
+
+	var best *weightedBackend
+	total := 0.0
+
+	for _, wb := range wrr.backends {
+		if wb.backend.IsDown() || wb.backend.Priority != priority {
+			continue
+		}
+
+		weight := wb.backend.EffectiveWeight(wrr.opts.slowStart)
+		wb.currentWeight += weight
+		total += weight
+
+		if best == nil || wb.currentWeight > best.currentWeight {
+			best = wb
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoAvailableBackends
+	}
+
+	best.currentWeight -= total
+	return best.backend, nil
+}
+
+func (wrr *WeightedRoundRobinBalancer) MarkAsDown(backend *Backend) {
+	if backend == nil {
+		return
+	}
+
+	backend.TripCircuit()
+	wrr.log.Error("backend marked as down", slog.String("url", backend.URL.String()))
+}
+
+// Добавляет новый бэкенд в список бэкендов, распределяемых балансировщиком
+func (wrr *WeightedRoundRobinBalancer) AddBackend(backend Backend) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	backendCopy := backend
+	wrr.backends = append(wrr.backends, &weightedBackend{backend: &backendCopy})
+	wrr.log.Info("backend added",
+		slog.String("url", backend.URL.String()),
+		slog.Int("weight", backend.Weight),
+	)
+}
+
+func (wrr *WeightedRoundRobinBalancer) RemoveBackend(url string) bool {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	for index, wb := range wrr.backends {
+		if wb.backend.URL.String() == url {
+			wrr.backends = append(wrr.backends[:index], wrr.backends[index+1:]...)
+			wrr.log.Info("backend removed", slog.String("url", url))
+			return true
+		}
+	}
+	return false
+}
+
+func (wrr *WeightedRoundRobinBalancer) GetAllBackends() []*Backend {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	backends := make([]*Backend, len(wrr.backends))
+	for i, wb := range wrr.backends {
+		backends[i] = wb.backend
+	}
+	return backends
+}
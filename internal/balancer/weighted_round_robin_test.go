@@ -0,0 +1,126 @@
+package balancer
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedRoundRobinBalancer(t *testing.T) {
+	createBackend := func(u string, weight int, down bool) *Backend {
+		parsedURL, _ := url.Parse(u)
+		return &Backend{
+			URL:    parsedURL,
+			Weight: weight,
+			isDown: down,
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	t.Run("No backends available", func(t *testing.T) {
+		wrr := NewWeightedRoundRobinBalancer(logger)
+		_, err := wrr.Next(nil)
+		assert.ErrorIs(t, err, ErrNoAvailableBackends)
+	})
+
+	t.Run("All backends down", func(t *testing.T) {
+		wrr := NewWeightedRoundRobinBalancer(logger)
+		wrr.AddBackend(*createBackend("http://server1.com", 1, true))
+		wrr.AddBackend(*createBackend("http://server2.com", 3, true))
+
+		_, err := wrr.Next(nil)
+		assert.ErrorIs(t, err, ErrNoAvailableBackends)
+	})
+
+	t.Run("Smooth weighted order", func(t *testing.T) {
+		wrr := NewWeightedRoundRobinBalancer(logger)
+		wrr.AddBackend(*createBackend("http://a.com", 5, false))
+		wrr.AddBackend(*createBackend("http://b.com", 1, false))
+		wrr.AddBackend(*createBackend("http://c.com", 1, false))
+
+		// последовательность nginx для весов {5, 1, 1}
+		expected := []string{"a", "a", "b", "a", "c", "a", "a"}
+		for i, name := range expected {
+			b, err := wrr.Next(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "http://"+name+".com", b.URL.String(), "step %d", i)
+		}
+	})
+
+	t.Run("Distribution follows weights", func(t *testing.T) {
+		wrr := NewWeightedRoundRobinBalancer(logger)
+		wrr.AddBackend(*createBackend("http://server1.com", 1, false))
+		wrr.AddBackend(*createBackend("http://server2.com", 3, false))
+
+		counts := make(map[string]int)
+		for i := 0; i < 400; i++ {
+			b, err := wrr.Next(nil)
+			assert.NoError(t, err)
+			counts[b.URL.String()]++
+		}
+
+		assert.Equal(t, 100, counts["http://server1.com"])
+		assert.Equal(t, 300, counts["http://server2.com"])
+	})
+
+	t.Run("Skip down backends", func(t *testing.T) {
+		wrr := NewWeightedRoundRobinBalancer(logger)
+		wrr.AddBackend(*createBackend("http://server1.com", 10, true))
+		wrr.AddBackend(*createBackend("http://server2.com", 1, false))
+
+		for i := 0; i < 5; i++ {
+			b, err := wrr.Next(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "http://server2.com", b.URL.String())
+		}
+	})
+
+	t.Run("Slow start for recovered backend", func(t *testing.T) {
+		wrr := NewWeightedRoundRobinBalancer(logger, WithSlowStart(time.Hour))
+		wrr.AddBackend(*createBackend("http://server1.com", 1, false))
+		wrr.AddBackend(*createBackend("http://server2.com", 1, true))
+
+		// восстановленный бэкенд начинает с 10% веса
+		wrr.GetAllBackends()[1].SetHealth(false)
+
+		counts := make(map[string]int)
+		for i := 0; i < 110; i++ {
+			b, err := wrr.Next(nil)
+			assert.NoError(t, err)
+			counts[b.URL.String()]++
+		}
+
+		assert.Equal(t, 100, counts["http://server1.com"])
+		assert.Equal(t, 10, counts["http://server2.com"])
+	})
+
+	t.Run("EffectiveWeight grows to full weight", func(t *testing.T) {
+		backend := createBackend("http://server1.com", 4, false)
+		assert.Equal(t, 4.0, backend.EffectiveWeight(time.Minute))
+
+		backend.recoveredAt = time.Now().Add(-30 * time.Second)
+		assert.InDelta(t, 2.0, backend.EffectiveWeight(time.Minute), 0.1)
+
+		backend.recoveredAt = time.Now().Add(-2 * time.Minute)
+		assert.Equal(t, 4.0, backend.EffectiveWeight(time.Minute))
+		assert.Equal(t, 4.0, backend.EffectiveWeight(0))
+	})
+
+	t.Run("Add and Remove backends", func(t *testing.T) {
+		wrr := NewWeightedRoundRobinBalancer(logger)
+		server := createBackend("http://server1.com", 2, false)
+
+		wrr.AddBackend(*server)
+		assert.Len(t, wrr.GetAllBackends(), 1)
+
+		assert.True(t, wrr.RemoveBackend(server.URL.String()))
+		assert.Len(t, wrr.GetAllBackends(), 0)
+
+		assert.False(t, wrr.RemoveBackend("http://invalid.com"))
+	})
+}
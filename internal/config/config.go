@@ -9,28 +9,277 @@ import (
 )
 
 type Config struct {
-	Env           string        `yaml:"env"`
-	Server        HTTPServer    `yaml:"httpserver"`
-	Backends      []Backend     `yaml:"backends"`
-	HealthChecker HealthChecker `yaml:"health_checker"`
-	RateLimiter   RateLimiter   `yaml:"rate_limiter"`
-	Storage       Storage       `yaml:"storage"`
+	Env           string         `yaml:"env"`
+	Server        HTTPServer     `yaml:"httpserver"`
+	Balancer      Balancer       `yaml:"balancer"`
+	Backends      []Backend      `yaml:"backends"`
+	Proxy         Proxy          `yaml:"proxy"`
+	HealthChecker HealthChecker  `yaml:"health_checker"`
+	Outlier       Outlier        `yaml:"outlier_detection"`
+	Breaker       CircuitBreaker `yaml:"circuit_breaker"`
+	RateLimiter   RateLimiter    `yaml:"rate_limiter"`
+	Storage       Storage        `yaml:"storage"`
+	// CIDR прокси, которым доверяются заголовки X-Forwarded-* и Forwarded
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type HTTPServer struct {
 	Port        int           `yaml:"port"`
 	Timeout     time.Duration `yaml:"timeout"`
 	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// принимать HTTP/2 без TLS (h2c) от клиентов
+	H2C           bool          `yaml:"h2c"`
+	ProxyProtocol ProxyProtocol `yaml:"proxy_protocol"`
+	TLS           TLS           `yaml:"tls"`
+}
+
+// HTTPS листенер, работает вместе с HTTP на port
+type TLS struct {
+	Enabled bool `yaml:"enabled"`
+	Port    int  `yaml:"port"`
+	// сертификат выбирается по SNI, первый используется по умолчанию
+	Certificates []Certificate `yaml:"certificates"`
+	// минимальная версия TLS: 1.0, 1.1, 1.2 (по умолчанию) или 1.3
+	MinVersion string `yaml:"min_version"`
+	// имена шифров для TLS 1.2 и ниже, пусто - набор Go по умолчанию
+	CipherSuites []string `yaml:"cipher_suites"`
+	// как часто проверяется изменение файлов сертификатов
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	// проверка сертификатов клиентов: none (по умолчанию), optional - проверять,
+	// если клиент его передал, require - без сертификата соединение отклоняется
+	ClientAuth string `yaml:"client_auth"`
+	// CA для проверки сертификатов клиентов
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+type Certificate struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// PROXY protocol v1/v2 на входящих соединениях, например от L4 балансировщика
+type ProxyProtocol struct {
+	Enabled bool `yaml:"enabled"`
+	// CIDR источников, от которых ожидается PROXY заголовок
+	TrustedSources []string `yaml:"trusted_sources"`
+	// время на получение заголовка после установки соединения
+	HeaderTimeout time.Duration `yaml:"header_timeout"`
+}
+
+type Balancer struct {
+	Algorithm string `yaml:"algorithm"`
+	// время, за которое вес нового или восстановленного бэкенда дорастает до полного
+	SlowStart time.Duration `yaml:"slow_start"`
+	// минимальная доля доступных бэкендов уровня приоритета, ниже которой
+	// трафик уходит на следующий уровень
+	PriorityThreshold float64      `yaml:"priority_threshold"`
+	Hash              HashBalancer `yaml:"hash"`
+}
+
+// Настройки consistent hashing
+type HashBalancer struct {
+	// источник ключа: ip, header, cookie или path
+	Key string `yaml:"key"`
+	// имя заголовка или cookie для key: header/cookie
+	KeyName string `yaml:"key_name"`
+	// кол-во виртуальных узлов на кольце для каждого бэкенда
+	Replicas int `yaml:"replicas"`
+	// consistent hashing with bounded loads: во сколько раз нагрузка бэкенда
+	// может превышать среднюю, прежде чем ключ уйдет на следующий бэкенд кольца
+	// (0 - без ограничения)
+	LoadFactor float64 `yaml:"load_factor"`
 }
 
 type Backend struct {
-	URL string `yaml:"url"`
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+	// уровень приоритета (0 - основной), бэкенды менее приоритетных уровней
+	// получают трафик, только когда в более приоритетном мало доступных бэкендов
+	Priority int `yaml:"priority"`
+	// протокол соединений с бэкендом: http1 (по умолчанию), h2 или h2c
+	Protocol string `yaml:"protocol"`
+	// отправлять бэкенду PROXY заголовок с адресом клиента: v1 или v2, пусто - не отправлять
+	ProxyProtocol string `yaml:"proxy_protocol"`
+	// TLS соединений с бэкендом по https
+	TLS BackendTLS `yaml:"tls"`
+	// переопределяет настройки соединений из proxy.transport
+	Transport Transport `yaml:"transport"`
+}
+
+// TLS к бэкенду: свой CA и клиентский сертификат для mTLS
+type BackendTLS struct {
+	// CA для проверки сертификата бэкенда, пусто - системные
+	CAFile string `yaml:"ca_file"`
+	// клиентский сертификат и ключ
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// имя для SNI и проверки сертификата вместо хоста из url
+	ServerName string `yaml:"server_name"`
+	// не проверять сертификат бэкенда, только для разработки
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+type Proxy struct {
+	StickySession StickySession `yaml:"sticky_session"`
+	Retry         Retry         `yaml:"retry"`
+	BodyBuffer    BodyBuffer    `yaml:"body_buffer"`
+	Hedge         Hedge         `yaml:"hedge"`
+	Transport     Transport     `yaml:"transport"`
+	Streaming     Streaming     `yaml:"streaming"`
+	// кол-во попыток на одном бэкенде
+	MaxRetries int `yaml:"max_retries"`
+	// кол-во бэкендов, на которые пробуется отправить запрос
+	MaxBackends int `yaml:"max_backends"`
+}
+
+// Потоковые ответы (SSE, NDJSON): отдаются клиенту сразу
+// и не ограничиваются общими таймаутами сервера
+type Streaming struct {
+	// типы содержимого потоковых ответов
+	ContentTypes []string `yaml:"content_types"`
+	// префиксы маршрутов, ответы которых всегда потоковые
+	PathPrefixes []string `yaml:"path_prefixes"`
+	// таймаут записи потокового ответа, 0 - без ограничения
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// поток закрывается, если бэкенд не присылает данных дольше idle_timeout
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+// Настройки соединений с бэкендами
+type Transport struct {
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	MaxIdleConns          int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"`
+}
+
+// Хеджированные запросы: если бэкенд не ответил за задержку, такой же запрос
+// отправляется на другой бэкенд, клиент получает первый ответ
+type Hedge struct {
+	Enabled bool `yaml:"enabled"`
+	// методы, запросы которых можно хеджировать
+	Methods []string `yaml:"methods"`
+	// префиксы маршрутов, пусто - все маршруты
+	PathPrefixes []string `yaml:"path_prefixes"`
+	// фиксированная задержка перед хеджированным запросом
+	Delay time.Duration `yaml:"delay"`
+	// перцентиль времени ответа (0-100), который используется как задержка,
+	// пока данных недостаточно используется delay
+	Percentile float64 `yaml:"percentile"`
+	// максимальное кол-во дополнительных запросов
+	MaxHedges int `yaml:"max_hedges"`
+}
+
+// Буферизация тела запроса, чтобы повторные попытки отправляли его целиком
+type BodyBuffer struct {
+	// размер тела в байтах, до которого оно хранится в памяти, больше - во временном файле
+	MemoryLimit int64 `yaml:"memory_limit"`
+	// максимальный размер буферизуемого тела, запросы с большим телом не повторяются
+	MaxSize int64 `yaml:"max_size"`
+	// каталог для временных файлов, по умолчанию системный
+	TempDir string `yaml:"temp_dir"`
+}
+
+// Политика повторных попыток, routes переопределяют ее для отдельных маршрутов
+type Retry struct {
+	RetryPolicy `yaml:",inline"`
+	Routes      []RetryRoute `yaml:"routes"`
+	Backoff     RetryBackoff `yaml:"backoff"`
+	Budget      RetryBudget  `yaml:"budget"`
+}
+
+// Экспоненциальная задержка между попытками с full jitter:
+// случайное время от 0 до min(max, base * 2^попытка)
+type RetryBackoff struct {
+	Base time.Duration `yaml:"base"`
+	Max  time.Duration `yaml:"max"`
+}
+
+// Общий бюджет повторов: за window повторов не больше, чем
+// ratio от всех запросов плюс min_per_second в секунду
+type RetryBudget struct {
+	Ratio        float64       `yaml:"ratio"`
+	MinPerSecond int           `yaml:"min_per_second"`
+	Window       time.Duration `yaml:"window"`
+}
+
+type RetryRoute struct {
+	PathPrefix  string `yaml:"path_prefix"`
+	RetryPolicy `yaml:",inline"`
+}
+
+// Незаданные поля наследуются от общей политики
+type RetryPolicy struct {
+	// методы, запросы которых можно повторять
+	Methods []string `yaml:"methods"`
+	// коды ответов, при которых запрос повторяется
+	StatusCodes []int `yaml:"status_codes"`
+	// connect_error - повторять только если соединение с бэкендом не установлено,
+	// any_error - при любой ошибке транспорта
+	On string `yaml:"on"`
+	// повторять запросы любых методов с заголовком Idempotency-Key
+	IdempotencyKey *bool `yaml:"idempotency_key"`
+	// статусы gRPC, при которых вызов повторяется
+	GRPCStatusCodes []int `yaml:"grpc_status_codes"`
+}
+
+// Привязка клиента к бэкенду через подписанную cookie
+type StickySession struct {
+	Enabled    bool   `yaml:"enabled"`
+	CookieName string `yaml:"cookie_name"`
+	// ключ для HMAC подписи cookie, если не задан генерируется при старте
+	Secret string        `yaml:"secret"`
+	TTL    time.Duration `yaml:"ttl"`
 }
 
 type HealthChecker struct {
 	Interval   time.Duration `yaml:"interval"`
 	HealthPath string        `yaml:"health_path"`
 	Timeout    time.Duration `yaml:"timeout"`
+	// http (по умолчанию) - GET health_path, grpc - gRPC Health Checking Protocol
+	Type string `yaml:"type"`
+	// имя сервиса для grpc.health.v1.Health/Check, пусто - весь сервер
+	GRPCService string `yaml:"grpc_service"`
+}
+
+// Пассивная проверка здоровья по ответам бэкендов
+type Outlier struct {
+	Enabled bool `yaml:"enabled"`
+	// как часто пересчитывается доля успешных ответов и возвращаются исключенные бэкенды
+	Interval time.Duration `yaml:"interval"`
+	// кол-во 5xx ответов подряд для исключения бэкенда
+	Consecutive5xx int `yaml:"consecutive_5xx"`
+	// кол-во ошибок соединения и 502/503/504 подряд для исключения бэкенда
+	ConsecutiveGatewayErrors int `yaml:"consecutive_gateway_errors"`
+	// окно, за которое считается доля успешных ответов
+	SuccessRateWindow time.Duration `yaml:"success_rate_window"`
+	// минимальное кол-во запросов в окне, чтобы учитывать долю успешных ответов
+	SuccessRateMinRequests int `yaml:"success_rate_min_requests"`
+	// бэкенд исключается, если доля успешных ответов ниже (0 - не учитывать)
+	SuccessRateThreshold float64 `yaml:"success_rate_threshold"`
+	// время исключения, умножается на кол-во исключений подряд
+	BaseEjectionTime time.Duration `yaml:"base_ejection_time"`
+	MaxEjectionTime  time.Duration `yaml:"max_ejection_time"`
+	// максимальный процент одновременно исключенных бэкендов
+	MaxEjectionPercent int `yaml:"max_ejection_percent"`
+}
+
+// Circuit breaker для каждого бэкенда
+type CircuitBreaker struct {
+	Enabled bool `yaml:"enabled"`
+	// кол-во ошибок подряд для перехода в open
+	ConsecutiveFailures int `yaml:"consecutive_failures"`
+	// доля ошибок за interval для перехода в open (0 - не учитывать)
+	ErrorRatio float64 `yaml:"error_ratio"`
+	// минимальное кол-во запросов за interval, чтобы учитывать долю ошибок
+	MinRequests int           `yaml:"min_requests"`
+	Interval    time.Duration `yaml:"interval"`
+	// время в open до перехода в half-open
+	Cooldown time.Duration `yaml:"cooldown"`
+	// кол-во пробных запросов в half-open
+	HalfOpenRequests int `yaml:"half_open_requests"`
 }
 
 type RateLimiter struct {
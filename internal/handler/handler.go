@@ -1,13 +1,14 @@
 package handler
 
 import (
+	"loadbalancer/internal/lib/trustedproxy"
 	"loadbalancer/internal/proxy"
 	ratelimiter "loadbalancer/internal/rate_limiter"
 	"log/slog"
 	"net/http"
 )
 
-func SetupHandlers(proxyHandler *proxy.ReverseProxy, rateLimiter *ratelimiter.RateLimiter, headerIP string, log *slog.Logger) http.Handler {
+func SetupHandlers(proxyHandler *proxy.ReverseProxy, rateLimiter *ratelimiter.RateLimiter, headerIP string, trusted *trustedproxy.List, log *slog.Logger) http.Handler {
 	mux := http.NewServeMux()
 
 	// эти обработчики так же будут учитывать rate limiter
@@ -18,11 +19,13 @@ func SetupHandlers(proxyHandler *proxy.ReverseProxy, rateLimiter *ratelimiter.Ra
 	mux.HandleFunc("PUT /api/clients/", updateClientHandler(rateLimiter, log))
 	mux.HandleFunc("DELETE /api/clients/", deleteClientHandler(rateLimiter, log))
 
+	mux.HandleFunc("GET /api/stats/retries", retryStatsHandler(proxyHandler, log))
+
 	mux.Handle("/", proxyHandler)
 
 	var handler http.Handler = mux
 	if rateLimiter != nil {
-		handler = RateLimiterMiddleware(rateLimiter, log, headerIP)(handler)
+		handler = RateLimiterMiddleware(rateLimiter, log, headerIP, trusted)(handler)
 	}
 	handler = LoggingMiddleware(handler, log)
 
@@ -2,11 +2,11 @@ package handler
 
 import (
 	"loadbalancer/internal/lib/api/response"
+	"loadbalancer/internal/lib/clientcert"
+	"loadbalancer/internal/lib/trustedproxy"
 	ratelimiter "loadbalancer/internal/rate_limiter"
 	"log/slog"
-	"net"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -15,10 +15,11 @@ func RateLimiterMiddleware(
 	limiter *ratelimiter.RateLimiter,
 	log *slog.Logger,
 	headerIP string,
+	trusted *trustedproxy.List,
 ) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientID := getClientID(r, headerIP)
+			clientID := getClientID(r, headerIP, trusted)
 
 			if !limiter.Allow(clientID) {
 				response.Error(w, http.StatusTooManyRequests, "Rate limit exeeded", log)
@@ -54,29 +55,28 @@ func LoggingMiddleware(next http.Handler, log *slog.Logger) http.Handler {
 	})
 }
 
-// Получаем id клиента из запроса
-func getClientID(r *http.Request, headerIP string) string {
+// Получаем id клиента из запроса. Заголовок headerIP учитывается, только если
+// запрос пришел от доверенного прокси, иначе клиент мог подставить любой адрес
+func getClientID(r *http.Request, headerIP string, trusted *trustedproxy.List) string {
+	// клиент с проверенным сертификатом получает отдельный лимит,
+	// заголовки запроса не позволяют ему сменить идентификатор
+	if subject, ok := clientcert.Subject(r); ok {
+		return "cert:" + subject
+	}
+
 	apiKey := r.Header.Get("X-API-Key")
 	if apiKey != "" {
 		return "api:" + apiKey
 	}
 
-	var ip string
-
-	if headerIP != "" {
-		headerIPs := r.Header.Get(headerIP)
-		if headerIPs != "" {
-			ip = strings.Split(headerIPs, ",")[0]
-			ip = strings.TrimSpace(ip)
-		}
+	ip, ok := trustedproxy.RemoteIP(r)
+	if !ok {
+		return "ip:" + r.RemoteAddr
 	}
 
-	if ip == "" {
-		ip, _, _ = net.SplitHostPort(r.RemoteAddr)
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
+	if headerIP != "" {
+		ip = trusted.ClientIP(ip, trustedproxy.Chain(r.Header, headerIP))
 	}
 
-	return "ip:" + ip
+	return "ip:" + ip.String()
 }
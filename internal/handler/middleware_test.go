@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"loadbalancer/internal/lib/trustedproxy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetClientID(t *testing.T) {
+	trusted, err := trustedproxy.New([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	request := func(remoteAddr, forwardedFor string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return r
+	}
+
+	t.Run("Header from untrusted client is ignored", func(t *testing.T) {
+		r := request("203.0.113.7:4000", "1.1.1.1")
+		assert.Equal(t, "ip:203.0.113.7", getClientID(r, "X-Forwarded-For", trusted))
+	})
+
+	t.Run("Header from trusted proxy is walked from the right", func(t *testing.T) {
+		// 1.1.1.1 подставлен клиентом 198.51.100.2
+		r := request("10.0.0.1:4000", "1.1.1.1, 198.51.100.2, 10.0.0.9")
+		assert.Equal(t, "ip:198.51.100.2", getClientID(r, "X-Forwarded-For", trusted))
+	})
+
+	t.Run("Without header_ip remote address is used", func(t *testing.T) {
+		r := request("10.0.0.1:4000", "1.1.1.1")
+		assert.Equal(t, "ip:10.0.0.1", getClientID(r, "", trusted))
+	})
+
+	t.Run("Without trusted proxies header is ignored", func(t *testing.T) {
+		r := request("10.0.0.1:4000", "1.1.1.1")
+		assert.Equal(t, "ip:10.0.0.1", getClientID(r, "X-Forwarded-For", nil))
+	})
+
+	t.Run("Verified client certificate", func(t *testing.T) {
+		r := request("203.0.113.7:4000", "")
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "billing"}},
+		}}}
+		assert.Equal(t, "cert:CN=billing", getClientID(r, "X-Forwarded-For", trusted))
+
+		// X-API-Key не заменяет subject проверенного сертификата
+		r.Header.Set("X-API-Key", "secret")
+		assert.Equal(t, "cert:CN=billing", getClientID(r, "X-Forwarded-For", trusted))
+		r.Header.Del("X-API-Key")
+
+		// непроверенный сертификат не учитывается
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "billing"}}}}
+		assert.Equal(t, "ip:203.0.113.7", getClientID(r, "X-Forwarded-For", trusted))
+	})
+
+	t.Run("API key has priority over address", func(t *testing.T) {
+		r := request("10.0.0.1:4000", "")
+		r.Header.Set("X-API-Key", "secret")
+		assert.Equal(t, "api:secret", getClientID(r, "X-Forwarded-For", trusted))
+	})
+}
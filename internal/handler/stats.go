@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"encoding/json"
+	"loadbalancer/internal/lib/sl"
+	"loadbalancer/internal/proxy"
+	"log/slog"
+	"net/http"
+)
+
+func retryStatsHandler(proxyHandler *proxy.ReverseProxy, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(proxyHandler.RetryStats()); err != nil {
+			log.Error("failed to encode retry stats", sl.Err(err))
+		}
+	}
+}
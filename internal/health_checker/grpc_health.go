@@ -0,0 +1,183 @@
+package healthchecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/lib/sl"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	CheckTypeHTTP = "http"
+	CheckTypeGRPC = "grpc"
+
+	grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+	// HealthCheckResponse.ServingStatus
+	grpcServing = 1
+)
+
+var (
+	ErrNotServing = errors.New("grpc service is not serving")
+)
+
+// Проверка по gRPC Health Checking Protocol (grpc.health.v1.Health/Check)
+func (hc *HealthChecker) checkGRPCHealth(backend *balancer.Backend) {
+	err := hc.grpcHealthCheck(backend)
+	wasHealthy := backend.IsHealthy()
+
+	if err != nil {
+		if wasHealthy {
+			hc.log.Warn("backend is down", slog.String("url", backend.URL.String()), sl.Err(err))
+			backend.SetHealth(true)
+		}
+		return
+	}
+
+	if !wasHealthy {
+		hc.log.Info("backend is back online", slog.String("url", backend.URL.String()))
+		backend.SetHealth(false)
+	}
+}
+
+func (hc *HealthChecker) grpcHealthCheck(backend *balancer.Backend) error {
+	checkURL := *backend.URL
+	checkURL.Path = grpcHealthCheckPath
+
+	body := grpcFrame(encodeHealthCheckRequest(hc.grpcService))
+	req, err := http.NewRequest(http.MethodPost, checkURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := hc.grpcClient(backend).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected http status %d", resp.StatusCode)
+	}
+
+	// статус gRPC приходит в трейлерах, они доступны после чтения тела
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// ответ Trailers-Only передает статус в заголовках
+	trailer := resp.Trailer
+	if resp.Header.Get("Grpc-Status") != "" {
+		trailer = resp.Header
+	}
+	if status := trailer.Get("Grpc-Status"); status != "0" {
+		return fmt.Errorf("grpc status %q: %s", status, trailer.Get("Grpc-Message"))
+	}
+
+	message, err := readGRPCFrame(data)
+	if err != nil {
+		return err
+	}
+	if servingStatus := decodeHealthCheckResponse(message); servingStatus != grpcServing {
+		return fmt.Errorf("%w: status %d", ErrNotServing, servingStatus)
+	}
+	return nil
+}
+
+// gRPC работает только поверх HTTP/2: для бэкендов с протоколом http1
+// используется h2c или h2 в зависимости от схемы
+func (hc *HealthChecker) grpcClient(backend *balancer.Backend) *http.Client {
+	protocol := balancer.ProtocolH2C
+	switch {
+	case backend.Protocol == balancer.ProtocolH2 || backend.Protocol == balancer.ProtocolH2C:
+		protocol = backend.Protocol
+	case backend.URL.Scheme == "https":
+		protocol = balancer.ProtocolH2
+	}
+
+	if backend.TLSConfig != nil {
+		return hc.tlsClient(backend, protocol)
+	}
+	return hc.clients[protocol]
+}
+
+// Сообщение gRPC: флаг сжатия и длина сообщения перед телом
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+func readGRPCFrame(data []byte) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, errors.New("grpc response is too short")
+	}
+	if data[0] != 0 {
+		return nil, errors.New("compressed grpc response is not supported")
+	}
+	size := binary.BigEndian.Uint32(data[1:5])
+	if uint32(len(data)-5) < size {
+		return nil, errors.New("grpc response is truncated")
+	}
+	return data[5 : 5+size], nil
+}
+
+// HealthCheckRequest{service = 1}
+func encodeHealthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	message := []byte{0x0a}
+	message = binary.AppendUvarint(message, uint64(len(service)))
+	return append(message, service...)
+}
+
+// HealthCheckResponse{status = 1}, возвращает 0 (UNKNOWN), если поля нет
+func decodeHealthCheckResponse(message []byte) uint64 {
+	var status uint64
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0
+		}
+		message = message[n:]
+
+		field, wireType := key>>3, key&7
+		switch wireType {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0
+			}
+			message = message[n:]
+			if field == 1 {
+				status = value
+			}
+		case 1:
+			if len(message) < 8 {
+				return 0
+			}
+			message = message[8:]
+		case 2:
+			size, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < size {
+				return 0
+			}
+			message = message[n+int(size):]
+		case 5:
+			if len(message) < 4 {
+				return 0
+			}
+			message = message[4:]
+		default:
+			return 0
+		}
+	}
+	return status
+}
@@ -0,0 +1,106 @@
+package healthchecker
+
+import (
+	"io"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCHealthCheck(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	// gRPC сервер проверки здоровья поверх h2c
+	newHealthServer := func(t *testing.T, handler func(w http.ResponseWriter, service string)) *url.URL {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, grpcHealthCheckPath, r.URL.Path)
+			assert.Equal(t, 2, r.ProtoMajor)
+
+			data, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			message, err := readGRPCFrame(data)
+			require.NoError(t, err)
+
+			service := ""
+			if len(message) > 2 {
+				service = string(message[2:])
+			}
+			handler(w, service)
+		}))
+		server.Config.Protocols = &http.Protocols{}
+		server.Config.Protocols.SetUnencryptedHTTP2(true)
+		server.Start()
+		t.Cleanup(server.Close)
+
+		u, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		return u
+	}
+
+	respond := func(status byte) func(w http.ResponseWriter, service string) {
+		return func(w http.ResponseWriter, service string) {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.Write(grpcFrame([]byte{0x08, status}))
+			w.Header().Set("Grpc-Status", "0")
+		}
+	}
+
+	cfg := config.HealthChecker{Type: CheckTypeGRPC, GRPCService: "orders"}
+
+	t.Run("Serving backend is healthy", func(t *testing.T) {
+		var requested string
+		u := newHealthServer(t, func(w http.ResponseWriter, service string) {
+			requested = service
+			respond(grpcServing)(w, service)
+		})
+
+		hc := NewHealthChecker(new(MockBalancer), logger, cfg)
+		backend := &balancer.Backend{URL: u}
+		backend.SetHealth(true)
+
+		hc.checkBackendHealth(backend)
+
+		assert.True(t, backend.IsHealthy())
+		assert.Equal(t, "orders", requested)
+	})
+
+	t.Run("Not serving backend is down", func(t *testing.T) {
+		u := newHealthServer(t, respond(2))
+
+		hc := NewHealthChecker(new(MockBalancer), logger, cfg)
+		backend := &balancer.Backend{URL: u}
+
+		hc.checkBackendHealth(backend)
+		assert.False(t, backend.IsHealthy())
+	})
+
+	t.Run("Error status is down", func(t *testing.T) {
+		u := newHealthServer(t, func(w http.ResponseWriter, service string) {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "unknown service")
+		})
+
+		hc := NewHealthChecker(new(MockBalancer), logger, cfg)
+		backend := &balancer.Backend{URL: u}
+
+		hc.checkBackendHealth(backend)
+		assert.False(t, backend.IsHealthy())
+	})
+
+	t.Run("Decode response", func(t *testing.T) {
+		assert.Equal(t, uint64(1), decodeHealthCheckResponse([]byte{0x08, 0x01}))
+		// неизвестное строковое поле пропускается
+		assert.Equal(t, uint64(2), decodeHealthCheckResponse([]byte{0x12, 0x01, 'x', 0x08, 0x02}))
+		assert.Equal(t, uint64(0), decodeHealthCheckResponse(nil))
+	})
+}
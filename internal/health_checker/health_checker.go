@@ -1,10 +1,13 @@
 package healthchecker
 
 import (
+	"context"
 	"loadbalancer/internal/balancer"
 	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/proxyproto"
 	"loadbalancer/internal/lib/sl"
 	"log/slog"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -19,6 +22,16 @@ type HealthChecker struct {
 	interval   time.Duration
 	healthPath string
 	timeout    time.Duration
+	// http или grpc
+	checkType   string
+	grpcService string
+	// клиенты для протоколов бэкендов (http1, h2, h2c)
+	clients map[string]*http.Client
+	// клиенты для бэкендов, которые ожидают PROXY заголовок (v1, v2)
+	proxyClients map[string]*http.Client
+	// клиенты для бэкендов со своими настройками TLS, по url и протоколу
+	tlsClients map[string]*http.Client
+	tlsMu      sync.Mutex
 	stopChan   chan struct{}
 	wg         sync.WaitGroup
 }
@@ -33,6 +46,9 @@ func NewHealthChecker(balancer balancer.Balancer, logger *slog.Logger, config co
 	if config.Timeout == 0 {
 		config.Timeout = 5 * time.Second
 	}
+	if config.Type == "" {
+		config.Type = CheckTypeHTTP
+	}
 
 	return &HealthChecker{
 		balancer:   balancer,
@@ -40,8 +56,95 @@ func NewHealthChecker(balancer balancer.Balancer, logger *slog.Logger, config co
 		interval:   config.Interval,
 		healthPath: config.HealthPath,
 		timeout:    config.Timeout,
-		stopChan:   make(chan struct{}),
+
+		checkType:    config.Type,
+		grpcService:  config.GRPCService,
+		clients:      newProtocolClients(config.Timeout),
+		proxyClients: newProxyProtocolClients(config.Timeout),
+		stopChan:     make(chan struct{}),
+	}
+}
+
+func newProtocolClients(timeout time.Duration) map[string]*http.Client {
+	clients := make(map[string]*http.Client)
+	for _, protocol := range []string{balancer.ProtocolHTTP1, balancer.ProtocolH2, balancer.ProtocolH2C} {
+		protocols, _ := balancer.HTTPProtocols(protocol)
+		clients[protocol] = &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{Protocols: protocols},
+		}
+	}
+	return clients
+}
+
+// Проверка отправляет заголовок без адреса клиента (v1 UNKNOWN, v2 LOCAL)
+func newProxyProtocolClients(timeout time.Duration) map[string]*http.Client {
+	clients := make(map[string]*http.Client)
+	for _, version := range []string{proxyproto.V1, proxyproto.V2} {
+		transport := &http.Transport{}
+		withLocalProxyHeader(transport, version)
+		clients[version] = &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		}
+	}
+	return clients
+}
+
+func withLocalProxyHeader(transport *http.Transport, version string) {
+	header := func(context.Context, net.Conn) ([]byte, error) {
+		return proxyproto.FormatLocal(version)
+	}
+	transport.DialContext = proxyproto.DialWithHeader((&net.Dialer{}).DialContext, header)
+	transport.DisableKeepAlives = true
+}
+
+// Клиент для бэкенда с клиентским сертификатом, своим CA или именем сервера.
+// Создается при первой проверке и переиспользуется
+func (hc *HealthChecker) tlsClient(backend *balancer.Backend, protocol string) *http.Client {
+	hc.tlsMu.Lock()
+	defer hc.tlsMu.Unlock()
+
+	key := protocol + " " + backend.URL.String()
+	if client, ok := hc.tlsClients[key]; ok {
+		return client
 	}
+
+	protocols, err := balancer.HTTPProtocols(protocol)
+	if err != nil {
+		protocols, _ = balancer.HTTPProtocols(balancer.ProtocolHTTP1)
+	}
+	transport := &http.Transport{
+		Protocols:       protocols,
+		TLSClientConfig: backend.TLSConfig,
+	}
+	if backend.ProxyProtocol != "" {
+		withLocalProxyHeader(transport, backend.ProxyProtocol)
+	}
+	client := &http.Client{
+		Timeout:   hc.timeout,
+		Transport: transport,
+	}
+
+	if hc.tlsClients == nil {
+		hc.tlsClients = make(map[string]*http.Client)
+	}
+	hc.tlsClients[key] = client
+	return client
+}
+
+// Клиент для протокола бэкенда
+func (hc *HealthChecker) client(backend *balancer.Backend) *http.Client {
+	if backend.TLSConfig != nil {
+		return hc.tlsClient(backend, backend.Protocol)
+	}
+	if client, ok := hc.proxyClients[backend.ProxyProtocol]; ok {
+		return client
+	}
+	if client, ok := hc.clients[backend.Protocol]; ok {
+		return client
+	}
+	return hc.clients[balancer.ProtocolHTTP1]
 }
 
 // Запускает периодические проверки здоровья бэкендов
@@ -86,16 +189,16 @@ func (hc *HealthChecker) checkAllBackends() {
 
 // Проверяет здоровье конкретного бэкенда
 func (hc *HealthChecker) checkBackendHealth(backend *balancer.Backend) {
+	if hc.checkType == CheckTypeGRPC {
+		hc.checkGRPCHealth(backend)
+		return
+	}
 
 	healthURL := *backend.URL
 	healthURL.Path = hc.healthPath
 
-	client := http.Client{
-		Timeout: hc.timeout,
-	}
-
-	resp, err := client.Get(healthURL.String())
-	wasHealthy := !backend.IsDown()
+	resp, err := hc.client(backend).Get(healthURL.String())
+	wasHealthy := backend.IsHealthy()
 
 	if err != nil {
 		if wasHealthy {
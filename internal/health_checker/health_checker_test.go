@@ -1,6 +1,7 @@
 package healthchecker
 
 import (
+	"encoding/pem"
 	"loadbalancer/internal/balancer"
 	"loadbalancer/internal/config"
 	"log/slog"
@@ -8,10 +9,12 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHealthChecker(t *testing.T) {
@@ -94,4 +97,26 @@ func TestHealthChecker(t *testing.T) {
 
 		assert.False(t, mockBackend.IsDown())
 	})
+
+	t.Run("Backend TLS settings are used for checks", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		caFile := filepath.Join(t.TempDir(), "ca.crt")
+		require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+		hc := NewHealthChecker(new(MockBalancer), logger, config.HealthChecker{Timeout: time.Second})
+
+		// сертификат httptest не подписан системными CA
+		backend, err := balancer.NewBackend(config.Backend{URL: server.URL})
+		require.NoError(t, err)
+		hc.checkBackendHealth(backend)
+		assert.False(t, backend.IsHealthy())
+
+		backend, err = balancer.NewBackend(config.Backend{URL: server.URL, TLS: config.BackendTLS{CAFile: caFile}})
+		require.NoError(t, err)
+		backend.SetHealth(true)
+		hc.checkBackendHealth(backend)
+		assert.True(t, backend.IsHealthy())
+	})
 }
@@ -2,6 +2,7 @@ package healthchecker
 
 import (
 	"loadbalancer/internal/balancer"
+	"net/http"
 	"net/url"
 	"sync"
 
@@ -37,8 +38,8 @@ type MockBalancer struct {
 	backends []*balancer.Backend
 }
 
-func (m *MockBalancer) Next() (*balancer.Backend, error) {
-	args := m.Called()
+func (m *MockBalancer) Next(r *http.Request) (*balancer.Backend, error) {
+	args := m.Called(r)
 	return args.Get(0).(*balancer.Backend), args.Error(1)
 }
 
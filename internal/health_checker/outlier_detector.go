@@ -0,0 +1,286 @@
+package healthchecker
+
+import (
+	"context"
+	"errors"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// кол-во интервалов, на которые делится окно подсчета доли успешных ответов
+const windowBuckets = 10
+
+// Пассивная проверка здоровья (outlier detection): по результатам реальных
+// запросов считает ошибки подряд и долю успешных ответов для каждого бэкенда.
+// Бэкенд-выброс исключается из балансировки на время, которое растет с каждым
+// повторным исключением, и возвращается автоматически
+type OutlierDetector struct {
+	balancer balancer.Balancer
+	log      *slog.Logger
+	cfg      config.Outlier
+	stats    map[*balancer.Backend]*outlierStats
+	mu       sync.Mutex
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+type outlierStats struct {
+	consecutive5xx           int
+	consecutiveGatewayErrors int
+	window                   slidingWindow
+	ejected                  bool
+	// кол-во исключений подряд, множитель времени исключения
+	ejections int
+}
+
+func NewOutlierDetector(lb balancer.Balancer, logger *slog.Logger, cfg config.Outlier) *OutlierDetector {
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Consecutive5xx == 0 {
+		cfg.Consecutive5xx = 5
+	}
+	if cfg.ConsecutiveGatewayErrors == 0 {
+		cfg.ConsecutiveGatewayErrors = 5
+	}
+	if cfg.SuccessRateWindow == 0 {
+		cfg.SuccessRateWindow = time.Minute
+	}
+	if cfg.SuccessRateMinRequests == 0 {
+		cfg.SuccessRateMinRequests = 100
+	}
+	if cfg.BaseEjectionTime == 0 {
+		cfg.BaseEjectionTime = 30 * time.Second
+	}
+	if cfg.MaxEjectionTime == 0 {
+		cfg.MaxEjectionTime = 300 * time.Second
+	}
+	if cfg.MaxEjectionPercent == 0 {
+		cfg.MaxEjectionPercent = 10
+	}
+
+	return &OutlierDetector{
+		balancer: lb,
+		log:      logger,
+		cfg:      cfg,
+		stats:    make(map[*balancer.Backend]*outlierStats),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Запускает периодический пересчет доли успешных ответов и возврат исключенных бэкендов
+func (od *OutlierDetector) Start() {
+	od.wg.Add(1)
+	go func() {
+		defer od.wg.Done()
+
+		ticker := time.NewTicker(od.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				od.evaluate(time.Now())
+			case <-od.stopChan:
+				return
+			}
+		}
+	}()
+
+	od.log.Info("outlier detector started", slog.String("interval", od.cfg.Interval.String()))
+}
+
+func (od *OutlierDetector) Stop() {
+	close(od.stopChan)
+	od.wg.Wait()
+	od.log.Info("outlier detector stopped")
+}
+
+// Учитывает результат запроса к бэкенду.
+// err - ошибка транспорта (соединение, таймаут), иначе status - код ответа.
+// Отмененные запросы не учитываются, бэкенд в отмене не виноват
+func (od *OutlierDetector) Report(backend *balancer.Backend, status int, err error) {
+	if od == nil || backend == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	now := time.Now()
+	gatewayError := err != nil ||
+		status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+	serverError := err != nil || status >= 500
+
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	stats := od.statsFor(backend)
+	stats.window.add(!serverError, now, od.cfg.SuccessRateWindow)
+
+	if !serverError {
+		stats.consecutive5xx = 0
+		stats.consecutiveGatewayErrors = 0
+		return
+	}
+
+	stats.consecutive5xx++
+	if gatewayError {
+		stats.consecutiveGatewayErrors++
+	}
+
+	switch {
+	case stats.consecutiveGatewayErrors >= od.cfg.ConsecutiveGatewayErrors:
+		od.eject(backend, stats, now, "consecutive gateway errors")
+	case stats.consecutive5xx >= od.cfg.Consecutive5xx:
+		od.eject(backend, stats, now, "consecutive 5xx")
+	}
+}
+
+// Возвращает исключенные бэкенды, у которых истекло время исключения,
+// и исключает бэкенды с низкой долей успешных ответов
+func (od *OutlierDetector) evaluate(now time.Time) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	current := make(map[*balancer.Backend]struct{})
+	for _, backend := range od.balancer.GetAllBackends() {
+		current[backend] = struct{}{}
+	}
+
+	for backend, stats := range od.stats {
+		// бэкенд удален из балансировщика
+		if _, ok := current[backend]; !ok {
+			delete(od.stats, backend)
+			continue
+		}
+
+		if stats.ejected {
+			if backend.IsEjected() {
+				continue
+			}
+			stats.ejected = false
+			od.log.Info("backend re-admitted after ejection", slog.String("url", backend.URL.String()))
+			continue
+		}
+
+		// бэкенд, проработавший интервал без исключения, постепенно
+		// "забывает" прошлые исключения
+		if stats.ejections > 0 {
+			stats.ejections--
+		}
+
+		if od.cfg.SuccessRateThreshold <= 0 {
+			continue
+		}
+
+		success, total := stats.window.counts(now, od.cfg.SuccessRateWindow)
+		if total < od.cfg.SuccessRateMinRequests {
+			continue
+		}
+		if float64(success)/float64(total) < od.cfg.SuccessRateThreshold {
+			od.eject(backend, stats, now, "low success rate")
+		}
+	}
+}
+
+// Исключает бэкенд, если не превышен процент одновременно исключенных.
+// Вызывается под блокировкой od.mu
+func (od *OutlierDetector) eject(backend *balancer.Backend, stats *outlierStats, now time.Time, reason string) {
+	if stats.ejected {
+		return
+	}
+
+	backends := od.balancer.GetAllBackends()
+	ejected := 0
+	for _, b := range backends {
+		if b.IsEjected() {
+			ejected++
+		}
+	}
+
+	// один бэкенд можно исключить всегда, даже если процент меньше одного бэкенда
+	maxEjected := len(backends) * od.cfg.MaxEjectionPercent / 100
+	if maxEjected < 1 {
+		maxEjected = 1
+	}
+	if ejected >= maxEjected {
+		od.log.Warn("outlier ejection skipped, max ejection percent reached",
+			slog.String("url", backend.URL.String()),
+			slog.String("reason", reason),
+		)
+		return
+	}
+
+	stats.ejections++
+	ejectionTime := od.cfg.BaseEjectionTime * time.Duration(stats.ejections)
+	if ejectionTime > od.cfg.MaxEjectionTime {
+		ejectionTime = od.cfg.MaxEjectionTime
+	}
+
+	backend.Eject(now.Add(ejectionTime))
+	stats.ejected = true
+	stats.consecutive5xx = 0
+	stats.consecutiveGatewayErrors = 0
+	stats.window.reset()
+
+	od.log.Warn("backend ejected",
+		slog.String("url", backend.URL.String()),
+		slog.String("reason", reason),
+		slog.String("duration", ejectionTime.String()),
+	)
+}
+
+// Вызывается под блокировкой od.mu
+func (od *OutlierDetector) statsFor(backend *balancer.Backend) *outlierStats {
+	stats, ok := od.stats[backend]
+	if !ok {
+		stats = &outlierStats{}
+		od.stats[backend] = stats
+	}
+	return stats
+}
+
+// Скользящее окно из windowBuckets интервалов со счетчиками успешных и всех запросов
+type slidingWindow struct {
+	buckets [windowBuckets]windowBucket
+}
+
+type windowBucket struct {
+	start   time.Time
+	success int
+	total   int
+}
+
+func (w *slidingWindow) add(success bool, now time.Time, window time.Duration) {
+	// окно короче windowBuckets наносекунд делится на интервалы по 1ns
+	size := max(window/windowBuckets, 1)
+	start := now.Truncate(size)
+	bucket := &w.buckets[(start.UnixNano()/int64(size))%windowBuckets]
+
+	if !bucket.start.Equal(start) {
+		*bucket = windowBucket{start: start}
+	}
+
+	bucket.total++
+	if success {
+		bucket.success++
+	}
+}
+
+func (w *slidingWindow) counts(now time.Time, window time.Duration) (success, total int) {
+	for _, bucket := range w.buckets {
+		if now.Sub(bucket.start) < window {
+			success += bucket.success
+			total += bucket.total
+		}
+	}
+	return success, total
+}
+
+func (w *slidingWindow) reset() {
+	w.buckets = [windowBuckets]windowBucket{}
+}
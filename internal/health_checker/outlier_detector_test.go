@@ -0,0 +1,166 @@
+package healthchecker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlierDetector(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	createBackends := func(n int) []*balancer.Backend {
+		backends := make([]*balancer.Backend, n)
+		for i := range backends {
+			u, _ := url.Parse("http://server" + string(rune('a'+i)) + ".com")
+			backends[i] = &balancer.Backend{URL: u}
+		}
+		return backends
+	}
+
+	t.Run("NewOutlierDetector set default values", func(t *testing.T) {
+		od := NewOutlierDetector(new(MockBalancer), logger, config.Outlier{})
+
+		assert.Equal(t, 10*time.Second, od.cfg.Interval)
+		assert.Equal(t, 5, od.cfg.Consecutive5xx)
+		assert.Equal(t, 5, od.cfg.ConsecutiveGatewayErrors)
+		assert.Equal(t, 30*time.Second, od.cfg.BaseEjectionTime)
+		assert.Equal(t, 10, od.cfg.MaxEjectionPercent)
+	})
+
+	t.Run("Eject after consecutive 5xx", func(t *testing.T) {
+		backends := createBackends(2)
+		mockBalancer := new(MockBalancer)
+		mockBalancer.On("GetAllBackends").Return(backends)
+
+		od := NewOutlierDetector(mockBalancer, logger, config.Outlier{Consecutive5xx: 3})
+
+		od.Report(backends[0], http.StatusInternalServerError, nil)
+		od.Report(backends[0], http.StatusInternalServerError, nil)
+		od.Report(backends[0], http.StatusOK, nil)
+		od.Report(backends[0], http.StatusInternalServerError, nil)
+		od.Report(backends[0], http.StatusInternalServerError, nil)
+		assert.False(t, backends[0].IsDown())
+
+		od.Report(backends[0], http.StatusInternalServerError, nil)
+		assert.True(t, backends[0].IsEjected())
+		assert.True(t, backends[0].IsDown())
+		assert.True(t, backends[0].IsHealthy())
+	})
+
+	t.Run("Eject after consecutive gateway errors", func(t *testing.T) {
+		backends := createBackends(2)
+		mockBalancer := new(MockBalancer)
+		mockBalancer.On("GetAllBackends").Return(backends)
+
+		od := NewOutlierDetector(mockBalancer, logger, config.Outlier{ConsecutiveGatewayErrors: 2})
+
+		od.Report(backends[1], 0, errors.New("connection refused"))
+		od.Report(backends[1], http.StatusBadGateway, nil)
+		assert.True(t, backends[1].IsEjected())
+	})
+
+	t.Run("Cancelled requests are ignored", func(t *testing.T) {
+		backends := createBackends(2)
+		mockBalancer := new(MockBalancer)
+		mockBalancer.On("GetAllBackends").Return(backends)
+
+		od := NewOutlierDetector(mockBalancer, logger, config.Outlier{ConsecutiveGatewayErrors: 1, Consecutive5xx: 1})
+
+		od.Report(backends[0], 0, context.Canceled)
+		od.Report(backends[0], 0, fmt.Errorf("proxy: %w", context.Canceled))
+		assert.False(t, backends[0].IsEjected())
+	})
+
+	t.Run("Tiny success rate window", func(t *testing.T) {
+		backends := createBackends(1)
+		od := NewOutlierDetector(new(MockBalancer), logger, config.Outlier{SuccessRateWindow: 5 * time.Nanosecond})
+
+		assert.NotPanics(t, func() {
+			od.Report(backends[0], http.StatusOK, nil)
+		})
+	})
+
+	t.Run("Max ejection percent", func(t *testing.T) {
+		backends := createBackends(4)
+		mockBalancer := new(MockBalancer)
+		mockBalancer.On("GetAllBackends").Return(backends)
+
+		od := NewOutlierDetector(mockBalancer, logger, config.Outlier{
+			Consecutive5xx:     1,
+			MaxEjectionPercent: 50,
+		})
+
+		for _, backend := range backends {
+			od.Report(backend, http.StatusInternalServerError, nil)
+		}
+
+		ejected := 0
+		for _, backend := range backends {
+			if backend.IsEjected() {
+				ejected++
+			}
+		}
+		assert.Equal(t, 2, ejected)
+	})
+
+	t.Run("Re-admission and growing ejection time", func(t *testing.T) {
+		backends := createBackends(1)
+		mockBalancer := new(MockBalancer)
+		mockBalancer.On("GetAllBackends").Return(backends)
+
+		od := NewOutlierDetector(mockBalancer, logger, config.Outlier{
+			Consecutive5xx:   1,
+			BaseEjectionTime: 50 * time.Millisecond,
+		})
+
+		od.Report(backends[0], http.StatusInternalServerError, nil)
+		assert.True(t, backends[0].IsEjected())
+
+		time.Sleep(60 * time.Millisecond)
+		assert.False(t, backends[0].IsDown())
+
+		od.evaluate(time.Now())
+		assert.False(t, od.stats[backends[0]].ejected)
+
+		// второе исключение подряд длится дольше
+		od.Report(backends[0], http.StatusInternalServerError, nil)
+		time.Sleep(60 * time.Millisecond)
+		assert.True(t, backends[0].IsEjected())
+	})
+
+	t.Run("Eject on low success rate", func(t *testing.T) {
+		backends := createBackends(2)
+		mockBalancer := new(MockBalancer)
+		mockBalancer.On("GetAllBackends").Return(backends)
+
+		od := NewOutlierDetector(mockBalancer, logger, config.Outlier{
+			Consecutive5xx:         100,
+			SuccessRateMinRequests: 10,
+			SuccessRateThreshold:   0.8,
+		})
+
+		for i := 0; i < 10; i++ {
+			status := http.StatusOK
+			if i%2 == 0 {
+				status = http.StatusInternalServerError
+			}
+			od.Report(backends[0], status, nil)
+			od.Report(backends[1], http.StatusOK, nil)
+		}
+
+		od.evaluate(time.Now())
+		assert.True(t, backends[0].IsEjected())
+		assert.False(t, backends[1].IsEjected())
+	})
+}
@@ -0,0 +1,17 @@
+package clientcert
+
+import (
+	"net/http"
+)
+
+// Заголовок, в котором бэкенд получает subject проверенного сертификата клиента
+const SubjectHeader = "X-Client-Cert-Subject"
+
+// Subject сертификата клиента, прошедшего проверку на TLS листенере.
+// Непроверенные сертификаты не учитываются
+func Subject(r *http.Request) (string, bool) {
+	if r == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String(), true
+}
@@ -0,0 +1,95 @@
+package proxyproto
+
+import (
+	"bufio"
+	"loadbalancer/internal/lib/trustedproxy"
+	"net"
+	"sync"
+	"time"
+)
+
+// Принимает соединения с PROXY заголовком от доверенных источников.
+// От остальных соединения принимаются как есть, заголовок не разбирается,
+// чтобы клиент не мог подменить свой адрес
+type Listener struct {
+	net.Listener
+	trusted       *trustedproxy.List
+	headerTimeout time.Duration
+}
+
+func NewListener(listener net.Listener, trusted *trustedproxy.List, headerTimeout time.Duration) *Listener {
+	return &Listener{
+		Listener:      listener,
+		trusted:       trusted,
+		headerTimeout: headerTimeout,
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted.Contains(AddrPort(conn.RemoteAddr()).Addr()) {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, headerTimeout: l.headerTimeout}, nil
+}
+
+// Соединение от доверенного источника. Заголовок читается при первом обращении,
+// а не в Accept, чтобы медленный клиент не задерживал прием остальных соединений
+type Conn struct {
+	net.Conn
+	headerTimeout time.Duration
+	reader        *bufio.Reader
+	remote        net.Addr
+	local         net.Addr
+	err           error
+	once          sync.Once
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		if c.headerTimeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+
+		c.reader = bufio.NewReader(c.Conn)
+		header, err := ReadHeader(c.reader)
+		if err != nil {
+			c.err = err
+			return
+		}
+		if header.Source.IsValid() {
+			c.remote = net.TCPAddrFromAddrPort(header.Source)
+			c.local = net.TCPAddrFromAddrPort(header.Destination)
+		}
+	})
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// Адрес клиента из заголовка
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// Адрес, к которому подключился клиент, из заголовка
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
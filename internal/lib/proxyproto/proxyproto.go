@@ -0,0 +1,251 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Версии заголовка HAProxy PROXY protocol
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+const (
+	// максимальная длина заголовка v1 вместе с CRLF
+	v1MaxLength = 107
+	v2HeaderLen = 16
+)
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	ErrNoHeader           = errors.New("proxy protocol header is missing")
+	ErrInvalidHeader      = errors.New("invalid proxy protocol header")
+	ErrUnknownVersion     = errors.New("unknown proxy protocol version")
+	ErrUnsupportedAddress = errors.New("unsupported address for proxy protocol")
+)
+
+// Адреса из заголовка. Пустой Source означает, что заголовок не передает адрес
+// клиента (v1 UNKNOWN, v2 LOCAL) и используется адрес соединения
+type Header struct {
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+}
+
+// Читает заголовок v1 или v2 в начале соединения
+func ReadHeader(r *bufio.Reader) (Header, error) {
+	peek, err := r.Peek(len(v1Signature))
+	if err != nil {
+		return Header{}, fmt.Errorf("%w: %w", ErrNoHeader, err)
+	}
+	if bytes.Equal(peek, v1Signature) {
+		return readV1(r)
+	}
+
+	peek, err = r.Peek(len(v2Signature))
+	if err != nil || !bytes.Equal(peek, v2Signature) {
+		return Header{}, ErrNoHeader
+	}
+	return readV2(r)
+}
+
+// PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n
+func readV1(r *bufio.Reader) (Header, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Header{}, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return Header{}, fmt.Errorf("%w: v1 header is too long", ErrInvalidHeader)
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return Header{}, fmt.Errorf("%w: v1 header must end with CRLF", ErrInvalidHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return Header{}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return Header{}, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	source, err := parseV1Address(fields[2], fields[4])
+	if err != nil {
+		return Header{}, err
+	}
+	destination, err := parseV1Address(fields[3], fields[5])
+	if err != nil {
+		return Header{}, err
+	}
+	tcp4 := fields[1] == "TCP4"
+	if source.Addr().Is4() != tcp4 || destination.Addr().Is4() != tcp4 {
+		return Header{}, fmt.Errorf("%w: address does not match %s", ErrInvalidHeader, fields[1])
+	}
+	return Header{Source: source, Destination: destination}, nil
+}
+
+func parseV1Address(ip, port string) (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	return netip.AddrPortFrom(addr, uint16(p)), nil
+}
+
+// Сигнатура, версия и команда, семейство адресов, длина и адреса.
+// TLV после адресов пропускаются
+func readV2(r *bufio.Reader) (Header, error) {
+	prefix := make([]byte, v2HeaderLen)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return Header{}, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	if prefix[12]>>4 != 2 {
+		return Header{}, fmt.Errorf("%w: version %d", ErrUnknownVersion, prefix[12]>>4)
+	}
+	command := prefix[12] & 0x0f
+	family := prefix[13]
+
+	data := make([]byte, binary.BigEndian.Uint16(prefix[14:16]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Header{}, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL: соединение от самого балансировщика, например проверка здоровья
+		return Header{}, nil
+	case 0x1:
+	default:
+		return Header{}, fmt.Errorf("%w: command %d", ErrInvalidHeader, command)
+	}
+
+	var size int
+	switch family {
+	case 0x11: // TCP over IPv4
+		size = 4
+	case 0x21: // TCP over IPv6
+		size = 16
+	default:
+		// UDP и unix сокеты не несут адреса TCP клиента
+		return Header{}, nil
+	}
+	if len(data) < 2*size+4 {
+		return Header{}, fmt.Errorf("%w: address block is too short", ErrInvalidHeader)
+	}
+
+	sourceIP, _ := netip.AddrFromSlice(data[:size])
+	destinationIP, _ := netip.AddrFromSlice(data[size : 2*size])
+	ports := data[2*size:]
+	return Header{
+		Source:      netip.AddrPortFrom(sourceIP, binary.BigEndian.Uint16(ports[0:2])),
+		Destination: netip.AddrPortFrom(destinationIP, binary.BigEndian.Uint16(ports[2:4])),
+	}, nil
+}
+
+// Формирует заголовок версии v1 или v2 для соединения с бэкендом
+func Format(version string, source, destination netip.AddrPort) ([]byte, error) {
+	source = netip.AddrPortFrom(source.Addr().Unmap(), source.Port())
+	destination = netip.AddrPortFrom(destination.Addr().Unmap(), destination.Port())
+	if !source.IsValid() || !destination.IsValid() || source.Addr().Is4() != destination.Addr().Is4() {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrUnsupportedAddress, source, destination)
+	}
+
+	switch version {
+	case V1:
+		proto := "TCP6"
+		if source.Addr().Is4() {
+			proto = "TCP4"
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n",
+			proto, source.Addr(), destination.Addr(), source.Port(), destination.Port()), nil
+	case V2:
+		header := append([]byte{}, v2Signature...)
+		// версия 2, команда PROXY
+		header = append(header, 0x21)
+		if source.Addr().Is4() {
+			header = append(header, 0x11)
+			header = binary.BigEndian.AppendUint16(header, 12)
+		} else {
+			header = append(header, 0x21)
+			header = binary.BigEndian.AppendUint16(header, 36)
+		}
+		header = append(header, source.Addr().AsSlice()...)
+		header = append(header, destination.Addr().AsSlice()...)
+		header = binary.BigEndian.AppendUint16(header, source.Port())
+		header = binary.BigEndian.AppendUint16(header, destination.Port())
+		return header, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+}
+
+// Заголовок без адреса клиента (v1 UNKNOWN, v2 LOCAL) для соединений
+// самого балансировщика, например проверок здоровья
+func FormatLocal(version string) ([]byte, error) {
+	switch version {
+	case V1:
+		return []byte("PROXY UNKNOWN\r\n"), nil
+	case V2:
+		header := append([]byte{}, v2Signature...)
+		return append(header, 0x20, 0x00, 0x00, 0x00), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+}
+
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Отправляет заголовок сразу после установки соединения
+func DialWithHeader(dial DialContextFunc, header func(ctx context.Context, conn net.Conn) ([]byte, error)) DialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := header(ctx, conn)
+		if err == nil {
+			_, err = conn.Write(data)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to send proxy protocol header: %w", err)
+		}
+		return conn, nil
+	}
+}
+
+// Проверяет значение proxy_protocol в конфиге, пустое - выключено
+func ValidVersion(version string) bool {
+	return version == "" || version == V1 || version == V2
+}
+
+// Адрес соединения в формате netip
+func AddrPort(addr net.Addr) netip.AddrPort {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.AddrPort()
+	}
+	addrPort, _ := netip.ParseAddrPort(addr.String())
+	return addrPort
+}
@@ -0,0 +1,148 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"loadbalancer/internal/lib/trustedproxy"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeader(t *testing.T) {
+	read := func(data []byte) (Header, []byte, error) {
+		r := bufio.NewReader(bytes.NewReader(data))
+		header, err := ReadHeader(r)
+		rest, _ := io.ReadAll(r)
+		return header, rest, err
+	}
+
+	t.Run("v1", func(t *testing.T) {
+		header, rest, err := read([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nGET / HTTP/1.1\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, netip.MustParseAddrPort("192.0.2.1:56324"), header.Source)
+		assert.Equal(t, netip.MustParseAddrPort("192.0.2.2:443"), header.Destination)
+		assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+
+		header, _, err = read([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 1000 80\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, netip.MustParseAddrPort("[2001:db8::1]:1000"), header.Source)
+
+		header, _, err = read([]byte("PROXY UNKNOWN\r\n"))
+		require.NoError(t, err)
+		assert.False(t, header.Source.IsValid())
+	})
+
+	t.Run("v1 invalid", func(t *testing.T) {
+		for _, data := range []string{
+			"PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n",
+			"PROXY TCP4 2001:db8::1 192.0.2.2 1 2\r\n",
+			"PROXY TCP4 192.0.2.1 2001:db8::2 1 2\r\n",
+			"PROXY TCP6 2001:db8::1 192.0.2.2 1 2\r\n",
+			"PROXY TCP4 192.0.2.1 192.0.2.2 70000 443\r\n",
+			"PROXY TCP4 192.0.2.1 192.0.2.2 1 443\n",
+			"PROXY " + string(bytes.Repeat([]byte("x"), 200)),
+		} {
+			_, _, err := read([]byte(data))
+			assert.ErrorIs(t, err, ErrInvalidHeader, data)
+		}
+	})
+
+	t.Run("v2 round trip", func(t *testing.T) {
+		for _, addrs := range [][2]string{
+			{"192.0.2.1:56324", "192.0.2.2:443"},
+			{"[2001:db8::1]:1000", "[2001:db8::2]:80"},
+		} {
+			source, destination := netip.MustParseAddrPort(addrs[0]), netip.MustParseAddrPort(addrs[1])
+			data, err := Format(V2, source, destination)
+			require.NoError(t, err)
+
+			header, rest, err := read(append(data, "body"...))
+			require.NoError(t, err)
+			assert.Equal(t, source, header.Source)
+			assert.Equal(t, destination, header.Destination)
+			assert.Equal(t, "body", string(rest))
+		}
+	})
+
+	t.Run("Local", func(t *testing.T) {
+		for _, version := range []string{V1, V2} {
+			data, err := FormatLocal(version)
+			require.NoError(t, err)
+
+			header, _, err := read(data)
+			require.NoError(t, err)
+			assert.False(t, header.Source.IsValid(), version)
+		}
+	})
+
+	t.Run("Missing header", func(t *testing.T) {
+		_, _, err := read([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrNoHeader)
+	})
+
+	t.Run("Mixed address families", func(t *testing.T) {
+		_, err := Format(V1, netip.MustParseAddrPort("192.0.2.1:1"), netip.MustParseAddrPort("[2001:db8::2]:80"))
+		assert.ErrorIs(t, err, ErrUnsupportedAddress)
+	})
+}
+
+func TestListener(t *testing.T) {
+	accept := func(t *testing.T, trusted []string, send []byte) net.Conn {
+		list, err := trustedproxy.New(trusted)
+		require.NoError(t, err)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listener := NewListener(ln, list, time.Second)
+		t.Cleanup(func() { listener.Close() })
+
+		client, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		_, err = client.Write(send)
+		require.NoError(t, err)
+
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	header, err := Format(V1, netip.MustParseAddrPort("203.0.113.9:4000"), netip.MustParseAddrPort("192.0.2.2:443"))
+	require.NoError(t, err)
+
+	t.Run("Trusted source", func(t *testing.T) {
+		conn := accept(t, []string{"127.0.0.0/8"}, append(header, "ping"...))
+
+		assert.Equal(t, "203.0.113.9:4000", conn.RemoteAddr().String())
+		assert.Equal(t, "192.0.2.2:443", conn.LocalAddr().String())
+
+		data := make([]byte, 4)
+		_, err := io.ReadFull(conn, data)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(data))
+	})
+
+	t.Run("Untrusted source is not parsed", func(t *testing.T) {
+		conn := accept(t, []string{"10.0.0.0/8"}, append(header, "ping"...))
+
+		assert.Equal(t, "127.0.0.1", AddrPort(conn.RemoteAddr()).Addr().String())
+		data := make([]byte, len(header))
+		_, err := io.ReadFull(conn, data)
+		require.NoError(t, err)
+		assert.Equal(t, header, data)
+	})
+
+	t.Run("Trusted source without header", func(t *testing.T) {
+		conn := accept(t, []string{"127.0.0.1"}, []byte("GET / HTTP/1.1\r\n"))
+
+		_, err := conn.Read(make([]byte, 16))
+		assert.ErrorIs(t, err, ErrNoHeader)
+	})
+}
@@ -0,0 +1,100 @@
+package trustedproxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Сети доверенных прокси, от которых принимаются заголовки X-Forwarded-*.
+// Пустой список (или nil) не доверяет никому
+type List struct {
+	prefixes []netip.Prefix
+}
+
+// Принимает CIDR (10.0.0.0/8) или отдельные адреса (127.0.0.1)
+func New(cidrs []string) (*List, error) {
+	list := &List{}
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			addr = addr.Unmap()
+			list.prefixes = append(list.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		list.prefixes = append(list.prefixes, prefix.Masked())
+	}
+	return list, nil
+}
+
+func (l *List) Contains(addr netip.Addr) bool {
+	if l == nil || !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Адрес клиента, который подключился к балансировщику
+func RemoteIP(r *http.Request) (netip.Addr, bool) {
+	return ParseIP(r.RemoteAddr)
+}
+
+// Разбирает адрес с портом или без, в том числе IPv6 в квадратных скобках
+func ParseIP(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// Цепочка адресов из заголовков вида X-Forwarded-For, слева направо
+func Chain(h http.Header, name string) []string {
+	var chain []string
+	for _, value := range h.Values(name) {
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				chain = append(chain, addr)
+			}
+		}
+	}
+	return chain
+}
+
+// Реальный адрес клиента. Цепочка проходится справа налево, начиная с remote:
+// адреса доверенных прокси пропускаются, первый недоверенный адрес и есть клиент.
+// Значения левее него мог подставить сам клиент, поэтому они не учитываются
+func (l *List) ClientIP(remote netip.Addr, chain []string) netip.Addr {
+	client := remote
+	for i := len(chain) - 1; i >= 0 && l.Contains(client); i-- {
+		addr, ok := ParseIP(chain[i])
+		if !ok {
+			break
+		}
+		client = addr
+	}
+	return client
+}
@@ -0,0 +1,68 @@
+package trustedproxy
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	list, err := New([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	require.NoError(t, err)
+
+	t.Run("Contains", func(t *testing.T) {
+		assert.True(t, list.Contains(netip.MustParseAddr("10.20.30.40")))
+		assert.True(t, list.Contains(netip.MustParseAddr("192.168.1.1")))
+		assert.True(t, list.Contains(netip.MustParseAddr("::ffff:10.0.0.1")))
+		assert.True(t, list.Contains(netip.MustParseAddr("fd00::1")))
+		assert.False(t, list.Contains(netip.MustParseAddr("192.168.1.2")))
+		assert.False(t, list.Contains(netip.Addr{}))
+
+		var empty *List
+		assert.False(t, empty.Contains(netip.MustParseAddr("10.0.0.1")))
+	})
+
+	t.Run("Invalid CIDR", func(t *testing.T) {
+		_, err := New([]string{"10.0.0.0/33"})
+		assert.Error(t, err)
+		_, err = New([]string{"proxy.local"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Client IP walks chain from the right", func(t *testing.T) {
+		h := http.Header{}
+		h.Add("X-Forwarded-For", "6.6.6.6, 1.2.3.4")
+		h.Add("X-Forwarded-For", "10.0.0.2")
+		chain := Chain(h, "X-Forwarded-For")
+		assert.Equal(t, []string{"6.6.6.6", "1.2.3.4", "10.0.0.2"}, chain)
+
+		// от недоверенного адреса цепочка не принимается
+		remote := netip.MustParseAddr("5.5.5.5")
+		assert.Equal(t, remote, list.ClientIP(remote, chain))
+
+		// 6.6.6.6 мог подставить клиент 1.2.3.4
+		assert.Equal(t, netip.MustParseAddr("1.2.3.4"), list.ClientIP(netip.MustParseAddr("10.0.0.1"), chain))
+
+		// все адреса доверенные - клиент самый левый
+		assert.Equal(t, netip.MustParseAddr("10.0.0.3"), list.ClientIP(netip.MustParseAddr("10.0.0.1"), []string{"10.0.0.3", "10.0.0.2"}))
+
+		// на некорректном значении проход останавливается
+		assert.Equal(t, netip.MustParseAddr("10.0.0.2"), list.ClientIP(netip.MustParseAddr("10.0.0.1"), []string{"garbage", "10.0.0.2"}))
+	})
+
+	t.Run("Parse IP", func(t *testing.T) {
+		addr, ok := ParseIP("[2001:db8::1]:8080")
+		assert.True(t, ok)
+		assert.Equal(t, netip.MustParseAddr("2001:db8::1"), addr)
+
+		addr, ok = ParseIP(" 1.2.3.4:80 ")
+		assert.True(t, ok)
+		assert.Equal(t, netip.MustParseAddr("1.2.3.4"), addr)
+
+		_, ok = ParseIP("unknown")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,359 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"loadbalancer/internal/config"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	defaultBodyMemoryLimit = 64 << 10
+	defaultBodyMaxSize     = 10 << 20
+)
+
+// Буферизует тела запросов: небольшие в памяти, остальные во временном файле
+type bodyBuffer struct {
+	memoryLimit int64
+	maxSize     int64
+	tempDir     string
+}
+
+func newBodyBuffer(cfg config.BodyBuffer) *bodyBuffer {
+	if cfg.MemoryLimit == 0 {
+		cfg.MemoryLimit = defaultBodyMemoryLimit
+	}
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = defaultBodyMaxSize
+	}
+	if cfg.MemoryLimit > cfg.MaxSize {
+		cfg.MemoryLimit = cfg.MaxSize
+	}
+
+	return &bodyBuffer{
+		memoryLimit: cfg.MemoryLimit,
+		maxSize:     cfg.MaxSize,
+		tempDir:     cfg.TempDir,
+	}
+}
+
+// Вычитывает тело запроса в буфер и выставляет req.GetBody для повторных попыток.
+// Если тело больше maxSize, возвращается nil: уже прочитанная часть и остаток
+// передаются потоком, и запрос нельзя повторить
+func (bb *bodyBuffer) buffer(req *http.Request) (*replayableBody, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return &replayableBody{}, nil
+	}
+	if req.ContentLength > bb.maxSize {
+		return nil, nil
+	}
+
+	var mem bytes.Buffer
+	n, err := io.CopyN(&mem, req.Body, bb.memoryLimit+1)
+	if errors.Is(err, io.EOF) {
+		req.Body.Close()
+		body := &replayableBody{data: mem.Bytes(), size: n}
+		body.attach(req)
+		return body, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	file, err := os.CreateTemp(bb.tempDir, "lb-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create body buffer file: %w", err)
+	}
+	body := &replayableBody{file: file}
+
+	written, err := mem.WriteTo(file)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to write body buffer file: %w", err)
+	}
+	rest, err := io.Copy(file, io.LimitReader(req.Body, bb.maxSize-written+1))
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	body.size = written + rest
+
+	if body.size > bb.maxSize {
+		req.Body = &streamedBody{
+			Reader: io.MultiReader(io.NewSectionReader(file, 0, body.size), req.Body),
+			origin: req.Body,
+			buffer: body,
+		}
+		return nil, nil
+	}
+
+	req.Body.Close()
+	body.attach(req)
+	return body, nil
+}
+
+// Тело запроса, которое можно прочитать несколько раз
+type replayableBody struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+func (b *replayableBody) attach(req *http.Request) {
+	req.Body = b.reader()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return b.reader(), nil
+	}
+}
+
+func (b *replayableBody) reader() io.ReadCloser {
+	if b.file != nil {
+		return io.NopCloser(io.NewSectionReader(b.file, 0, b.size))
+	}
+	return io.NopCloser(bytes.NewReader(b.data))
+}
+
+// Удаляет временный файл, если тело было сброшено на диск
+func (b *replayableBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	if removeErr := os.Remove(b.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// Тело больше лимита: начало читается из временного файла, остаток из запроса
+type streamedBody struct {
+	io.Reader
+	origin io.Closer
+	buffer *replayableBody
+
+	// тело закрывает транспорт, а если запрос до него не дошел - RoundTrip
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (b *streamedBody) Close() error {
+	b.closeOnce.Do(func() {
+		b.closeErr = b.origin.Close()
+		if bufferErr := b.buffer.Close(); b.closeErr == nil {
+			b.closeErr = bufferErr
+		}
+	})
+	return b.closeErr
+}
+
+var errBodyNotReplayable = errors.New("request body exceeds buffer limit and cannot be replayed")
+
+// Тело потокового запроса (gRPC, потоковые маршруты), которое не вычитывается
+// заранее, а записывается по мере отправки на бэкенд: клиент стрима может ждать
+// ответа, не закончив отправку тела. Пока записано не больше maxSize, следующая
+// попытка отправляет записанную часть и продолжает читать тело клиента,
+// поэтому unary вызовы повторяются так же, как буферизованные запросы
+type recordedBody struct {
+	origin      io.ReadCloser
+	memoryLimit int64
+	maxSize     int64
+	tempDir     string
+
+	// читать тело клиента может только одна попытка
+	readMu sync.Mutex
+
+	mu   sync.Mutex
+	data []byte
+	file *os.File
+	// прочитано из тела клиента
+	size     int64
+	overflow bool
+	eof      bool
+	err      error
+	current  *bodyCursor
+}
+
+func (bb *bodyBuffer) record(req *http.Request) *recordedBody {
+	body := &recordedBody{
+		origin:      req.Body,
+		memoryLimit: bb.memoryLimit,
+		maxSize:     bb.maxSize,
+		tempDir:     bb.tempDir,
+	}
+	req.Body = body.cursor()
+	req.GetBody = func() (io.ReadCloser, error) {
+		if !body.replayable() {
+			return nil, errBodyNotReplayable
+		}
+		return body.cursor(), nil
+	}
+	return body
+}
+
+// Тело можно отправить еще раз: все прочитанное записано
+func (b *recordedBody) replayable() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.overflow && b.err == nil
+}
+
+// Новое чтение тела с начала, предыдущее прекращается
+func (b *recordedBody) cursor() *bodyCursor {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current != nil {
+		b.current.closed = true
+	}
+	b.current = &bodyCursor{body: b}
+	return b.current
+}
+
+// Удаляет временный файл, тело клиента закрывает сервер
+func (b *recordedBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = nil
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	if removeErr := os.Remove(b.file.Name()); err == nil {
+		err = removeErr
+	}
+	b.file = nil
+	return err
+}
+
+// Вызывается под блокировкой b.mu
+func (b *recordedBody) store(p []byte) error {
+	if b.overflow {
+		return nil
+	}
+	if b.size+int64(len(p)) > b.maxSize {
+		b.overflow = true
+		b.data = nil
+		return nil
+	}
+
+	if b.file == nil && b.size+int64(len(p)) > b.memoryLimit {
+		file, err := os.CreateTemp(b.tempDir, "lb-body-*")
+		if err != nil {
+			return fmt.Errorf("failed to create body buffer file: %w", err)
+		}
+		if _, err := file.Write(b.data); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return fmt.Errorf("failed to write body buffer file: %w", err)
+		}
+		b.file = file
+		b.data = nil
+	}
+
+	if b.file != nil {
+		if _, err := b.file.Write(p); err != nil {
+			return fmt.Errorf("failed to write body buffer file: %w", err)
+		}
+		return nil
+	}
+	b.data = append(b.data, p...)
+	return nil
+}
+
+// Вызывается под блокировкой b.mu
+func (b *recordedBody) readAt(p []byte, off int64) (int, error) {
+	if b.file != nil {
+		return b.file.ReadAt(p[:min(int64(len(p)), b.size-off)], off)
+	}
+	return copy(p, b.data[off:b.size]), nil
+}
+
+// Чтение записанного тела одной попыткой
+type bodyCursor struct {
+	body   *recordedBody
+	offset int64
+	// попытка завершена или ее сменила следующая
+	closed bool
+}
+
+func (c *bodyCursor) Read(p []byte) (int, error) {
+	b := c.body
+	for {
+		if n, err, ok := c.readStored(p); ok {
+			return n, err
+		}
+
+		b.readMu.Lock()
+		b.mu.Lock()
+		// пока ждали, тело могла дочитать другая попытка
+		behind := c.offset < b.size || b.eof || b.err != nil || c.closed
+		b.mu.Unlock()
+		if behind {
+			b.readMu.Unlock()
+			continue
+		}
+
+		n, err := b.origin.Read(p)
+
+		b.mu.Lock()
+		if storeErr := b.store(p[:n]); storeErr != nil && b.err == nil {
+			b.err = storeErr
+		}
+		b.size += int64(n)
+		c.offset += int64(n)
+		switch {
+		case errors.Is(err, io.EOF):
+			b.eof = true
+		case err != nil && b.err == nil:
+			b.err = err
+		}
+		b.mu.Unlock()
+		b.readMu.Unlock()
+
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+}
+
+// Чтение уже записанной части, ok=false если нужно читать тело клиента
+func (c *bodyCursor) readStored(p []byte) (int, error, bool) {
+	b := c.body
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case c.closed:
+		return 0, http.ErrBodyReadAfterClose, true
+	case c.offset < b.size:
+		if b.overflow {
+			return 0, errBodyNotReplayable, true
+		}
+		n, err := b.readAt(p, c.offset)
+		c.offset += int64(n)
+		return n, err, true
+	case b.eof:
+		return 0, io.EOF, true
+	case b.err != nil:
+		return 0, b.err, true
+	}
+	return 0, nil, false
+}
+
+// Транспорт закрывает тело по завершении попытки, тело клиента остается открытым
+// для следующей попытки
+func (c *bodyCursor) Close() error {
+	c.body.mu.Lock()
+	defer c.body.mu.Unlock()
+	c.closed = true
+	return nil
+}
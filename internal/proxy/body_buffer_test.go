@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"io"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyBuffer(t *testing.T) {
+	readAll := func(t *testing.T, req *http.Request) string {
+		body, err := req.GetBody()
+		require.NoError(t, err)
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("Small body is kept in memory", func(t *testing.T) {
+		bb := newBodyBuffer(config.BodyBuffer{MemoryLimit: 16, MaxSize: 64})
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("payload"))
+
+		body, err := bb.buffer(req)
+		require.NoError(t, err)
+		require.NotNil(t, body)
+		assert.Nil(t, body.file)
+
+		assert.Equal(t, "payload", readAll(t, req))
+		assert.Equal(t, "payload", readAll(t, req))
+	})
+
+	t.Run("Large body is spilled to file", func(t *testing.T) {
+		dir := t.TempDir()
+		bb := newBodyBuffer(config.BodyBuffer{MemoryLimit: 4, MaxSize: 64, TempDir: dir})
+		payload := strings.Repeat("x", 32)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(payload))
+
+		body, err := bb.buffer(req)
+		require.NoError(t, err)
+		require.NotNil(t, body)
+		require.NotNil(t, body.file)
+
+		assert.Equal(t, payload, readAll(t, req))
+		assert.Equal(t, payload, readAll(t, req))
+
+		require.NoError(t, body.Close())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Body over limit is streamed", func(t *testing.T) {
+		dir := t.TempDir()
+		bb := newBodyBuffer(config.BodyBuffer{MemoryLimit: 4, MaxSize: 16, TempDir: dir})
+		payload := strings.Repeat("y", 40)
+		req := httptest.NewRequest(http.MethodPut, "/", io.NopCloser(strings.NewReader(payload)))
+		req.ContentLength = -1
+
+		body, err := bb.buffer(req)
+		require.NoError(t, err)
+		assert.Nil(t, body)
+
+		data, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, payload, string(data))
+
+		require.NoError(t, req.Body.Close())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Recorded body is replayed", func(t *testing.T) {
+		dir := t.TempDir()
+		bb := newBodyBuffer(config.BodyBuffer{MemoryLimit: 4, MaxSize: 64, TempDir: dir})
+		payload := strings.Repeat("r", 32)
+		req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader(payload)))
+
+		body := bb.record(req)
+
+		// первая попытка читает только часть тела клиента
+		first, err := req.GetBody()
+		require.NoError(t, err)
+		part := make([]byte, 10)
+		_, err = io.ReadFull(first, part)
+		require.NoError(t, err)
+
+		// следующая попытка получает записанную часть и остаток тела
+		assert.True(t, body.replayable())
+		assert.Equal(t, payload, readAll(t, req))
+		assert.Equal(t, payload, readAll(t, req))
+
+		_, err = first.Read(part)
+		assert.ErrorIs(t, err, http.ErrBodyReadAfterClose)
+
+		require.NoError(t, body.Close())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Recorded body over limit is not replayed", func(t *testing.T) {
+		bb := newBodyBuffer(config.BodyBuffer{MemoryLimit: 4, MaxSize: 16, TempDir: t.TempDir()})
+		payload := strings.Repeat("s", 40)
+		req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader(payload)))
+
+		body := bb.record(req)
+		data, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, payload, string(data))
+
+		assert.False(t, body.replayable())
+		_, err = req.GetBody()
+		assert.ErrorIs(t, err, errBodyNotReplayable)
+		require.NoError(t, body.Close())
+	})
+
+	t.Run("Retry sends full body", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+		var calls atomic.Int32
+		var received atomic.Value
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			received.Store(string(data))
+		}))
+		t.Cleanup(server.Close)
+
+		lb := balancer.NewRoundRobinBalancer(logger)
+		backend, err := balancer.NewBackend(config.Backend{URL: server.URL})
+		require.NoError(t, err)
+		lb.AddBackend(*backend)
+
+		cfg := config.Proxy{BodyBuffer: config.BodyBuffer{MemoryLimit: 8, TempDir: t.TempDir()}}
+		proxy, err := NewReverseProxy(lb, cfg, logger, WithCircuitBreaker())
+		require.NoError(t, err)
+
+		payload := strings.Repeat("z", 100)
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(payload)))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int32(2), calls.Load())
+		assert.Equal(t, payload, received.Load())
+	})
+
+	t.Run("Streamed body file is removed when no backend is tried", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+		dir := t.TempDir()
+
+		lb := balancer.NewRoundRobinBalancer(logger)
+		cfg := config.Proxy{BodyBuffer: config.BodyBuffer{MemoryLimit: 4, MaxSize: 16, TempDir: dir}}
+		proxy, err := NewReverseProxy(lb, cfg, logger)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPut, "/", io.NopCloser(strings.NewReader(strings.Repeat("t", 40))))
+		req.ContentLength = -1
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		assert.NotEqual(t, http.StatusOK, rec.Code)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"loadbalancer/internal/lib/clientcert"
+	"loadbalancer/internal/lib/trustedproxy"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"strings"
+)
+
+// Заголовки, которые сохраняются только от доверенных прокси
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Real-IP",
+}
+
+// Выставляет X-Forwarded-For/Host/Proto, X-Real-IP и Forwarded (RFC 7239).
+// Значения от доверенного прокси дополняются, от остальных клиентов заменяются
+type forwardedHeaders struct {
+	trusted *trustedproxy.List
+}
+
+// Rewrite для httputil.ReverseProxy, вызывается один раз на запрос,
+// поэтому повторы и хеджирование не дублируют заголовки
+func (f *forwardedHeaders) rewrite(pr *httputil.ProxyRequest) {
+	in, out := pr.In, pr.Out
+	out.Header.Set("X-Origin-Host", in.Host)
+
+	remote, ok := trustedproxy.RemoteIP(in)
+	if f.trusted.Contains(remote) {
+		// ReverseProxy удаляет заголовки перед Rewrite, возвращаются значения клиента
+		for _, name := range forwardingHeaders {
+			if values := in.Header.Values(name); len(values) > 0 {
+				out.Header[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+	} else {
+		out.Header.Del("X-Real-IP")
+	}
+
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+
+	if ok {
+		chain := trustedproxy.Chain(out.Header, "X-Forwarded-For")
+		if out.Header.Get("X-Real-IP") == "" {
+			out.Header.Set("X-Real-IP", f.trusted.ClientIP(remote, chain).String())
+		}
+		out.Header.Set("X-Forwarded-For", strings.Join(append(chain, remote.String()), ", "))
+	}
+	if out.Header.Get("X-Forwarded-Host") == "" {
+		out.Header.Set("X-Forwarded-Host", in.Host)
+	}
+	if out.Header.Get("X-Forwarded-Proto") == "" {
+		out.Header.Set("X-Forwarded-Proto", proto)
+	}
+
+	element := "for=" + forwardedNode(remote, ok) + ";host=" + forwardedValue(in.Host) + ";proto=" + proto
+	if forwarded := out.Header.Values("Forwarded"); len(forwarded) > 0 {
+		element = strings.Join(forwarded, ", ") + ", " + element
+	}
+	out.Header.Set("Forwarded", element)
+
+	// subject задает только балансировщик после проверки сертификата клиента
+	out.Header.Del(clientcert.SubjectHeader)
+	if subject, ok := clientcert.Subject(in); ok {
+		out.Header.Set(clientcert.SubjectHeader, subject)
+	}
+}
+
+// Адрес узла для Forwarded: IPv6 в квадратных скобках и кавычках
+func forwardedNode(addr netip.Addr, ok bool) string {
+	switch {
+	case !ok:
+		return "unknown"
+	case addr.Is6():
+		return `"[` + addr.String() + `]"`
+	}
+	return addr.String()
+}
+
+// Значение, которое не является token, передается в кавычках
+func forwardedValue(value string) string {
+	if value != "" && !strings.ContainsFunc(value, func(r rune) bool { return !isTokenRune(r) }) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func isTokenRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/trustedproxy"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	// бэкенд возвращает заголовки последнего запроса
+	newProxy := func(t *testing.T, trusted []string, failures int) (*ReverseProxy, *http.Header) {
+		var received http.Header
+		backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Clone()
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		t.Cleanup(backendServer.Close)
+
+		lb := balancer.NewRoundRobinBalancer(logger)
+		backend, err := balancer.NewBackend(config.Backend{URL: backendServer.URL})
+		require.NoError(t, err)
+		lb.AddBackend(*backend)
+
+		list, err := trustedproxy.New(trusted)
+		require.NoError(t, err)
+
+		cfg := config.Proxy{Retry: config.Retry{Backoff: config.RetryBackoff{Base: time.Millisecond, Max: time.Millisecond}}}
+		proxy, err := NewReverseProxy(lb, cfg, logger, WithTrustedProxies(list))
+		require.NoError(t, err)
+		return proxy, &received
+	}
+
+	spoofed := func(remoteAddr string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://lb.example.com/api", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "1.1.1.1, 10.0.0.5")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "spoofed.example.com")
+		req.Header.Set("X-Real-IP", "1.1.1.1")
+		req.Header.Set("Forwarded", "for=1.1.1.1;proto=https")
+		return req
+	}
+
+	t.Run("Untrusted client values are overwritten", func(t *testing.T) {
+		proxy, received := newProxy(t, []string{"10.0.0.0/8"}, 0)
+
+		proxy.ServeHTTP(httptest.NewRecorder(), spoofed("203.0.113.7:5555"))
+
+		h := *received
+		assert.Equal(t, "203.0.113.7", h.Get("X-Forwarded-For"))
+		assert.Equal(t, "203.0.113.7", h.Get("X-Real-IP"))
+		assert.Equal(t, "http", h.Get("X-Forwarded-Proto"))
+		assert.Equal(t, "lb.example.com", h.Get("X-Forwarded-Host"))
+		assert.Equal(t, "lb.example.com", h.Get("X-Origin-Host"))
+		assert.Equal(t, []string{"for=203.0.113.7;host=lb.example.com;proto=http"}, h.Values("Forwarded"))
+	})
+
+	t.Run("Trusted proxy values are kept and appended", func(t *testing.T) {
+		proxy, received := newProxy(t, []string{"10.0.0.0/8"}, 0)
+
+		req := spoofed("10.1.2.3:5555")
+		req.Header.Del("X-Real-IP")
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+		h := *received
+		assert.Equal(t, "1.1.1.1, 10.0.0.5, 10.1.2.3", h.Get("X-Forwarded-For"))
+		// 10.0.0.5 тоже доверенный, клиент - первый недоверенный адрес справа
+		assert.Equal(t, "1.1.1.1", h.Get("X-Real-IP"))
+		assert.Equal(t, "https", h.Get("X-Forwarded-Proto"))
+		assert.Equal(t, "spoofed.example.com", h.Get("X-Forwarded-Host"))
+		assert.Equal(t, []string{"for=1.1.1.1;proto=https, for=10.1.2.3;host=lb.example.com;proto=http"}, h.Values("Forwarded"))
+	})
+
+	t.Run("Retries do not duplicate headers", func(t *testing.T) {
+		proxy, received := newProxy(t, nil, 2)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, spoofed("[2001:db8::1]:5555"))
+
+		h := *received
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"2001:db8::1"}, h.Values("X-Forwarded-For"))
+		assert.Equal(t, []string{"lb.example.com"}, h.Values("X-Forwarded-Host"))
+		assert.Equal(t, []string{"lb.example.com"}, h.Values("X-Origin-Host"))
+		assert.Equal(t, []string{`for="[2001:db8::1]";host=lb.example.com;proto=http`}, h.Values("Forwarded"))
+	})
+
+	t.Run("Client certificate subject", func(t *testing.T) {
+		proxy, received := newProxy(t, nil, 0)
+
+		req := spoofed("203.0.113.7:5555")
+		req.Header.Set("X-Client-Cert-Subject", "CN=admin")
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Empty(t, received.Get("X-Client-Cert-Subject"))
+
+		req = spoofed("203.0.113.7:5555")
+		req.Header.Set("X-Client-Cert-Subject", "CN=admin")
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "orders"}},
+		}}}
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, []string{"CN=orders"}, received.Values("X-Client-Cert-Subject"))
+		assert.Equal(t, "https", received.Get("X-Forwarded-Proto"))
+	})
+}
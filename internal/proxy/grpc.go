@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Коды статусов gRPC
+const (
+	grpcCanceled         = 1
+	grpcUnknown          = 2
+	grpcDeadlineExceeded = 4
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+	grpcDataLoss         = 15
+)
+
+var defaultRetryGRPCStatusCodes = []int{grpcUnavailable}
+
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// Статус gRPC из заголовков ответа. Есть только у ответов без тела (Trailers-Only),
+// обычно это ошибки; у остальных статус приходит в трейлерах после тела
+func grpcStatus(resp *http.Response) (int, bool) {
+	value := resp.Header.Get("Grpc-Status")
+	if value == "" {
+		return 0, false
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return grpcUnknown, true
+	}
+	return code, true
+}
+
+// Код ответа бэкенда для учета ошибок: статусы gRPC приводятся к HTTP кодам,
+// чтобы circuit breaker и outlier detection учитывали ошибки gRPC сервисов
+func backendStatus(resp *http.Response) int {
+	code, ok := grpcStatus(resp)
+	if !ok || resp.StatusCode != http.StatusOK {
+		return resp.StatusCode
+	}
+
+	switch code {
+	case grpcUnavailable:
+		return http.StatusServiceUnavailable
+	case grpcDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case grpcInternal, grpcUnknown, grpcDataLoss:
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+// Ответ gRPC с ошибкой в формате Trailers-Only
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", grpcEncodeMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// Статус gRPC для ошибки проксирования
+func grpcErrorCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return grpcCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcDeadlineExceeded
+	}
+	return grpcUnavailable
+}
+
+// grpc-message кодируется percent-encoding
+func grpcEncodeMessage(message string) string {
+	return strings.ReplaceAll(url.PathEscape(message), "%20", " ")
+}
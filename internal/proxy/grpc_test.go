@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"io"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPC(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	h2cProtocols := func() *http.Protocols {
+		protocols := &http.Protocols{}
+		protocols.SetUnencryptedHTTP2(true)
+		return protocols
+	}
+
+	newBackend := func(t *testing.T, handler http.HandlerFunc) config.Backend {
+		server := httptest.NewUnstartedServer(handler)
+		server.Config.Protocols = h2cProtocols()
+		server.Start()
+		t.Cleanup(server.Close)
+		return config.Backend{URL: server.URL, Protocol: balancer.ProtocolH2C}
+	}
+
+	// прокси принимает h2c, как gRPC клиенты без TLS
+	newFront := func(t *testing.T, backends ...config.Backend) *httptest.Server {
+		lb := balancer.NewRoundRobinBalancer(logger)
+		for _, backendCfg := range backends {
+			backend, err := balancer.NewBackend(backendCfg)
+			require.NoError(t, err)
+			lb.AddBackend(*backend)
+		}
+
+		cfg := config.Proxy{Retry: config.Retry{Backoff: config.RetryBackoff{Base: time.Millisecond, Max: time.Millisecond}}}
+		proxy, err := NewReverseProxy(lb, cfg, logger, WithCircuitBreaker(), WithBackends(backends))
+		require.NoError(t, err)
+
+		front := httptest.NewUnstartedServer(proxy)
+		front.Config.Protocols = h2cProtocols()
+		front.Start()
+		t.Cleanup(front.Close)
+		return front
+	}
+
+	client := &http.Client{Transport: &http.Transport{Protocols: h2cProtocols()}}
+
+	call := func(t *testing.T, url string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, url+"/orders.Orders/Get", strings.NewReader("\x00\x00\x00\x00\x00"))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write([]byte("\x00\x00\x00\x00\x02ok"))
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "")
+	}
+
+	t.Run("Trailers are forwarded", func(t *testing.T) {
+		front := newFront(t, newBackend(t, ok))
+
+		resp := call(t, front.URL)
+		assert.Equal(t, 2, resp.ProtoMajor)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "\x00\x00\x00\x00\x02ok", string(body))
+		assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+	})
+
+	t.Run("Unavailable is retried", func(t *testing.T) {
+		var unavailableCalls atomic.Int32
+		unavailable := func(w http.ResponseWriter, r *http.Request) {
+			unavailableCalls.Add(1)
+			io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "14")
+		}
+
+		front := newFront(t, newBackend(t, unavailable), newBackend(t, ok))
+
+		resp := call(t, front.URL)
+		io.ReadAll(resp.Body)
+		assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+		// бэкенд повторяется maxRetries раз, затем запрос уходит на следующий
+		assert.Equal(t, int32(defaultMaxRetries), unavailableCalls.Load())
+	})
+
+	t.Run("Connect errors are retried", func(t *testing.T) {
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		front := newFront(t, config.Backend{URL: down.URL, Protocol: balancer.ProtocolH2C}, newBackend(t, ok))
+
+		for range 2 {
+			resp := call(t, front.URL)
+			io.ReadAll(resp.Body)
+			assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+		}
+	})
+
+	t.Run("Bidi stream is not buffered", func(t *testing.T) {
+		echo := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+
+			message := make([]byte, 7)
+			for {
+				if _, err := io.ReadFull(r.Body, message); err != nil {
+					break
+				}
+				w.Write(message)
+				w.(http.Flusher).Flush()
+			}
+			w.Header().Set("Grpc-Status", "0")
+		}
+
+		front := newFront(t, newBackend(t, echo))
+
+		body, stream := io.Pipe()
+		req, err := http.NewRequest(http.MethodPost, front.URL+"/chat.Chat/Talk", body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+
+		messages := []string{"\x00\x00\x00\x00\x02hi", "\x00\x00\x00\x00\x02yo"}
+		// первое сообщение отправляется вместе с заголовками вызова
+		go stream.Write([]byte(messages[0]))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			resp, err := client.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			// клиент отправляет следующее сообщение только после ответа на предыдущее
+			reply := make([]byte, 7)
+			for i, message := range messages {
+				if i > 0 {
+					stream.Write([]byte(message))
+				}
+				if _, err := io.ReadFull(resp.Body, reply); !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, message, string(reply))
+			}
+			stream.Close()
+			io.ReadAll(resp.Body)
+			assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			stream.CloseWithError(io.ErrUnexpectedEOF)
+			t.Fatal("bidi stream is blocked")
+		}
+	})
+
+	t.Run("Other statuses are not retried", func(t *testing.T) {
+		notFound := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "5")
+		}
+
+		front := newFront(t, newBackend(t, notFound), newBackend(t, ok))
+
+		resp := call(t, front.URL)
+		assert.Equal(t, "5", resp.Header.Get("Grpc-Status"))
+	})
+
+	t.Run("No backend available", func(t *testing.T) {
+		front := newFront(t)
+
+		resp := call(t, front.URL)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "14", resp.Header.Get("Grpc-Status"))
+		assert.NotEmpty(t, resp.Header.Get("Grpc-Message"))
+	})
+}
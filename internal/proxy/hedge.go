@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHedgeDelay     = 100 * time.Millisecond
+	defaultMaxHedges      = 1
+	hedgeLatencySamples   = 1000
+	hedgePercentileUpdate = 100
+)
+
+var (
+	ErrNoFreeBackend = errors.New("no backend available for hedged request")
+)
+
+// Решает, какие запросы можно хеджировать, и через сколько отправлять дубликат
+type hedgePolicy struct {
+	methods      map[string]struct{}
+	pathPrefixes []string
+	delay        time.Duration
+	maxHedges    int
+	latency      *latencyTracker
+}
+
+func newHedgePolicy(cfg config.Hedge) (*hedgePolicy, error) {
+	if cfg.Methods == nil {
+		cfg.Methods = []string{http.MethodGet, http.MethodHead}
+	}
+	if cfg.Delay == 0 {
+		cfg.Delay = defaultHedgeDelay
+	}
+	if cfg.MaxHedges == 0 {
+		cfg.MaxHedges = defaultMaxHedges
+	}
+	if cfg.Percentile < 0 || cfg.Percentile >= 100 {
+		return nil, fmt.Errorf("hedge percentile must be in range [0, 100), got %v", cfg.Percentile)
+	}
+
+	policy := &hedgePolicy{
+		methods:      make(map[string]struct{}, len(cfg.Methods)),
+		pathPrefixes: cfg.PathPrefixes,
+		delay:        cfg.Delay,
+		maxHedges:    cfg.MaxHedges,
+	}
+	for _, method := range cfg.Methods {
+		policy.methods[strings.ToUpper(method)] = struct{}{}
+	}
+	if cfg.Percentile > 0 {
+		policy.latency = newLatencyTracker(cfg.Percentile)
+	}
+	return policy, nil
+}
+
+// Хеджируются только запросы без тела с разрешенным методом и маршрутом
+func (hp *hedgePolicy) hedgeable(r *http.Request) bool {
+	if r.Body != nil && r.Body != http.NoBody {
+		return false
+	}
+	if _, ok := hp.methods[r.Method]; !ok {
+		return false
+	}
+	if len(hp.pathPrefixes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(hp.pathPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	})
+}
+
+// Задержка перед дополнительным запросом: перцентиль времени ответа, если он уже посчитан
+func (hp *hedgePolicy) hedgeDelay() time.Duration {
+	if d, ok := hp.latency.value(); ok {
+		return d
+	}
+	return hp.delay
+}
+
+// Отправляет дополнительные запросы на другие бэкенды, если первый не ответил
+// за задержку. Первый полученный ответ отдается клиенту, остальные отменяются
+type hedgingRoundTripper struct {
+	next   http.RoundTripper
+	policy *hedgePolicy
+	log    *slog.Logger
+}
+
+type hedgeResult struct {
+	leg    int
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+func (ht *hedgingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !ht.policy.hedgeable(req) {
+		return ht.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	// бэкенды, занятые запросами, общие для всех попыток
+	ctx := withUsedBackends(req.Context(), &backendSet{})
+	results := make(chan hedgeResult, ht.policy.maxHedges+1)
+	cancels := make([]context.CancelFunc, 0, ht.policy.maxHedges+1)
+
+	launch := func() {
+		legCtx, cancel := context.WithCancel(ctx)
+		leg := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := ht.next.RoundTrip(req.WithContext(legCtx))
+			results <- hedgeResult{leg: leg, resp: resp, err: err, cancel: cancel}
+		}()
+	}
+
+	launch()
+	pending := 1
+
+	timer := time.NewTimer(ht.policy.hedgeDelay())
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) > ht.policy.maxHedges {
+				continue
+			}
+			ht.log.Debug("sending hedged request",
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Int("hedge", len(cancels)),
+			)
+			launch()
+			pending++
+			timer.Reset(ht.policy.hedgeDelay())
+
+		case res := <-results:
+			pending--
+
+			if res.err != nil {
+				lastErr = res.err
+				res.cancel()
+				if pending > 0 {
+					continue
+				}
+				return nil, lastErr
+			}
+
+			// первый ответ выигрывает, остальные запросы отменяются
+			for leg, cancel := range cancels {
+				if leg != res.leg {
+					cancel()
+				}
+			}
+			go drainHedges(results, pending)
+
+			ht.policy.latency.observe(time.Since(start))
+			if res.leg > 0 {
+				ht.log.Debug("hedged request won",
+					slog.String("path", req.URL.Path),
+					slog.Int("hedge", res.leg),
+				)
+			}
+
+			resp := res.resp
+			resp.Body = newTrackedBody(resp.Body, res.cancel)
+			return resp, nil
+		}
+	}
+}
+
+// Дожидается отмененных запросов и закрывает их ответы
+func drainHedges(results <-chan hedgeResult, pending int) {
+	for range pending {
+		res := <-results
+		if res.resp != nil {
+			res.resp.Body.Close()
+		}
+		res.cancel()
+	}
+}
+
+type usedBackendsKey struct{}
+
+// Бэкенды, на которые уже ушли попытки хеджированного запроса
+type backendSet struct {
+	backends map[*balancer.Backend]struct{}
+	mu       sync.Mutex
+}
+
+func withUsedBackends(ctx context.Context, set *backendSet) context.Context {
+	return context.WithValue(ctx, usedBackendsKey{}, set)
+}
+
+func usedBackends(ctx context.Context) *backendSet {
+	set, _ := ctx.Value(usedBackendsKey{}).(*backendSet)
+	return set
+}
+
+// Занимает бэкенд, возвращает false если он уже занят.
+// Для nil набора бэкенд всегда свободен
+func (s *backendSet) claim(backend *balancer.Backend) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.backends == nil {
+		s.backends = make(map[*balancer.Backend]struct{})
+	}
+	if _, ok := s.backends[backend]; ok {
+		return false
+	}
+	s.backends[backend] = struct{}{}
+	return true
+}
+
+// Хранит последние времена ответа и периодически пересчитывает перцентиль
+type latencyTracker struct {
+	percentile float64
+	samples    []time.Duration
+	next       int
+	observed   int
+	current    atomic.Int64
+	mu         sync.Mutex
+}
+
+func newLatencyTracker(percentile float64) *latencyTracker {
+	return &latencyTracker{
+		percentile: percentile,
+		samples:    make([]time.Duration, 0, hedgeLatencySamples),
+	}
+}
+
+func (lt *latencyTracker) observe(d time.Duration) {
+	if lt == nil {
+		return
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) < hedgeLatencySamples {
+		lt.samples = append(lt.samples, d)
+	} else {
+		lt.samples[lt.next] = d
+		lt.next = (lt.next + 1) % hedgeLatencySamples
+	}
+
+	lt.observed++
+	if lt.observed%hedgePercentileUpdate == 0 {
+		sorted := slices.Clone(lt.samples)
+		slices.Sort(sorted)
+		idx := int(float64(len(sorted)-1) * lt.percentile / 100)
+		lt.current.Store(int64(sorted[idx]))
+	}
+}
+
+// Перцентиль времени ответа, false пока собрано мало данных
+func (lt *latencyTracker) value() (time.Duration, bool) {
+	if lt == nil {
+		return 0, false
+	}
+	d := time.Duration(lt.current.Load())
+	return d, d > 0
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	healthchecker "loadbalancer/internal/health_checker"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedge(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	newProxy := func(t *testing.T, cfg config.Hedge, handlers ...http.HandlerFunc) *ReverseProxy {
+		lb := balancer.NewRoundRobinBalancer(logger)
+		for _, handler := range handlers {
+			server := httptest.NewServer(handler)
+			t.Cleanup(server.Close)
+
+			backend, err := balancer.NewBackend(config.Backend{URL: server.URL})
+			require.NoError(t, err)
+			lb.AddBackend(*backend)
+		}
+
+		proxy, err := NewReverseProxy(lb, config.Proxy{Hedge: cfg}, logger)
+		require.NoError(t, err)
+		return proxy
+	}
+
+	t.Run("Hedged request wins and slow one is cancelled", func(t *testing.T) {
+		cancelled := make(chan struct{})
+		slow := func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(2 * time.Second):
+				w.Write([]byte("slow"))
+			}
+		}
+		fast := func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("fast"))
+		}
+
+		proxy := newProxy(t, config.Hedge{Enabled: true, Delay: 20 * time.Millisecond}, slow, fast)
+
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, "fast", rec.Body.String())
+		assert.Less(t, time.Since(start), time.Second)
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("slow request was not cancelled")
+		}
+	})
+
+	t.Run("Cancelled hedge is not a backend failure", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		}))
+		t.Cleanup(slow.Close)
+		fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("fast"))
+		}))
+		t.Cleanup(fast.Close)
+
+		// одной ошибки достаточно, чтобы открыть breaker и исключить бэкенд
+		lb := balancer.NewRoundRobinBalancer(logger)
+		for _, url := range []string{slow.URL, fast.URL} {
+			backend, err := balancer.NewBackend(config.Backend{URL: url})
+			require.NoError(t, err)
+			backend.ConfigureCircuitBreaker(config.CircuitBreaker{Enabled: true, ConsecutiveFailures: 1})
+			lb.AddBackend(*backend)
+		}
+		outlier := healthchecker.NewOutlierDetector(lb, logger, config.Outlier{
+			ConsecutiveGatewayErrors: 1,
+			Consecutive5xx:           1,
+			MaxEjectionPercent:       100,
+		})
+
+		cfg := config.Proxy{Hedge: config.Hedge{Enabled: true, Delay: 20 * time.Millisecond}}
+		proxy, err := NewReverseProxy(lb, cfg, logger, WithCircuitBreaker(), WithOutlierDetector(outlier))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, "fast", rec.Body.String())
+
+		slowBackend := lb.GetAllBackends()[0]
+		require.Equal(t, slow.URL, slowBackend.URL.String())
+		// отмененная попытка завершается после ответа клиенту
+		require.Eventually(t, func() bool {
+			return slowBackend.ActiveConnections() == 0
+		}, time.Second, 5*time.Millisecond)
+
+		assert.Never(t, func() bool {
+			return slowBackend.CircuitState() != balancer.CircuitClosed || slowBackend.IsEjected()
+		}, 100*time.Millisecond, 10*time.Millisecond)
+		assert.Zero(t, proxy.RetryStats().Retries)
+	})
+
+	t.Run("Not hedgeable route", func(t *testing.T) {
+		slow := func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("slow"))
+		}
+		fast := func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("fast"))
+		}
+
+		cfg := config.Hedge{Enabled: true, Delay: 10 * time.Millisecond, PathPrefixes: []string{"/search"}}
+		proxy := newProxy(t, cfg, slow, fast)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		assert.Equal(t, "slow", rec.Body.String())
+	})
+
+	t.Run("Latency percentile", func(t *testing.T) {
+		tracker := newLatencyTracker(90)
+		_, ok := tracker.value()
+		assert.False(t, ok)
+
+		for i := range hedgePercentileUpdate {
+			tracker.observe(time.Duration(i+1) * time.Millisecond)
+		}
+
+		value, ok := tracker.value()
+		assert.True(t, ok)
+		assert.Equal(t, 90*time.Millisecond, value)
+	})
+}
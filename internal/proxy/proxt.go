@@ -1,59 +1,224 @@
 package proxy
 
 import (
+	"fmt"
 	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	healthchecker "loadbalancer/internal/health_checker"
+	"loadbalancer/internal/lib/sl"
+	"loadbalancer/internal/lib/trustedproxy"
 	"log/slog"
-	"net"
 	"net/http"
 	"net/http/httputil"
-	"time"
 )
 
 type ReverseProxy struct {
-	balanver balancer.Balancer
-	log      *slog.Logger
+	balanver  balancer.Balancer
+	sticky    *stickySession
+	outlier   *healthchecker.OutlierDetector
+	breaker   bool
+	retry     *retryPolicies
+	bodies    *bodyBuffer
+	backoff   *retryBackoff
+	budget    *retryBudget
+	hedge     *hedgePolicy
+	backends  []config.Backend
+	streaming *streamingPolicy
+	forwarded *forwardedHeaders
+	proxy     *httputil.ReverseProxy
+	// отдельный прокси для Upgrade запросов без повторов
+	upgradeProxy *httputil.ReverseProxy
+	tunnels      tunnels
+	log          *slog.Logger
 }
 
-// cейчас создается новый транспорт при каждом запросе, что не очень хорошо
-// по хорошему надо сделать транспорт переиспользуемым и наверное сделать pool транспортов
-func NewReverseProxy(balancer balancer.Balancer, log *slog.Logger) *ReverseProxy {
-	return &ReverseProxy{
-		balanver: balancer,
-		log:      log,
+type Option func(*ReverseProxy)
+
+// Результаты запросов передаются в outlier detection,
+// вместо пометки бэкенда недоступным после неудачных попыток
+func WithOutlierDetector(detector *healthchecker.OutlierDetector) Option {
+	return func(p *ReverseProxy) {
+		p.outlier = detector
 	}
 }
 
-var defaultTransport = &http.Transport{
-	DialContext:           (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
-	TLSHandshakeTimeout:   5 * time.Second,
-	ResponseHeaderTimeout: 2 * time.Second,
-	ExpectContinueTimeout: 1 * time.Second,
-	IdleConnTimeout:       90 * time.Second,
-	MaxIdleConns:          100,
-	MaxIdleConnsPerHost:   10,
+// Бэкенды исключаются своими circuit breaker,
+// вместо пометки недоступным после неудачных попыток
+func WithCircuitBreaker() Option {
+	return func(p *ReverseProxy) {
+		p.breaker = true
+	}
 }
 
-func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// Бэкенды с собственными настройками транспорта
+func WithBackends(backends []config.Backend) Option {
+	return func(p *ReverseProxy) {
+		p.backends = backends
+	}
+}
 
-	transport := &retryRoundTripper{
-		next:        defaultTransport,
-		maxRetries:  3,
-		maxBackends: 5,
-		balancer:    p.balanver,
-		log:         p.log,
+// Прокси, от которых принимаются заголовки X-Forwarded-* и Forwarded
+func WithTrustedProxies(trusted *trustedproxy.List) Option {
+	return func(p *ReverseProxy) {
+		p.forwarded = &forwardedHeaders{trusted: trusted}
 	}
+}
 
-	p.log.Info("proxy request",
+const (
+	defaultMaxRetries  = 3
+	defaultMaxBackends = 5
+)
+
+// Прокси и транспорты создаются один раз и переиспользуются всеми запросами
+func NewReverseProxy(balancer balancer.Balancer, cfg config.Proxy, log *slog.Logger, opts ...Option) (*ReverseProxy, error) {
+	p := &ReverseProxy{
+		balanver:  balancer,
+		forwarded: &forwardedHeaders{},
+		log:       log,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	retry, err := newRetryPolicies(cfg.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry policy: %w", err)
+	}
+	p.retry = retry
+	p.bodies = newBodyBuffer(cfg.BodyBuffer)
+	p.backoff = newRetryBackoff(cfg.Retry.Backoff)
+	p.budget = newRetryBudget(cfg.Retry.Budget)
+
+	if cfg.Hedge.Enabled {
+		hedge, err := newHedgePolicy(cfg.Hedge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hedge policy: %w", err)
+		}
+		p.hedge = hedge
+	}
+
+	if cfg.StickySession.Enabled {
+		sticky, err := newStickySession(cfg.StickySession, balancer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init sticky sessions: %w", err)
+		}
+		if cfg.StickySession.Secret == "" {
+			log.Warn("sticky session secret is not set, cookies will be invalidated on restart")
+		}
+		p.sticky = sticky
+	}
+
+	transports, err := newTransportPool(cfg.Transport, p.backends)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init transports: %w", err)
+	}
+
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.MaxBackends == 0 {
+		cfg.MaxBackends = defaultMaxBackends
+	}
+
+	streamTransports, err := newTransportPool(cfg.Transport, p.backends, withoutResponseHeaderTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init streaming transports: %w", err)
+	}
+
+	p.streaming = newStreamingPolicy(cfg.Streaming)
+	var transport http.RoundTripper = &retryRoundTripper{
+		next: &streamingTransport{
+			policy:  p.streaming,
+			next:    transports,
+			streams: streamTransports,
+		},
+		maxRetries:     cfg.MaxRetries,
+		maxBackends:    cfg.MaxBackends,
+		balancer:       p.balanver,
+		sticky:         p.sticky,
+		outlier:        p.outlier,
+		circuitBreaker: p.breaker,
+		retry:          p.retry,
+		bodies:         p.bodies,
+		backoff:        p.backoff,
+		budget:         p.budget,
+		streaming:      p.streaming,
+		log:            p.log,
+	}
+	if p.hedge != nil {
+		transport = &hedgingRoundTripper{
+			next:   transport,
+			policy: p.hedge,
+			log:    p.log,
+		}
+	}
+
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		Transport:      transport,
+		ModifyResponse: p.streaming.modifyResponse,
+		ErrorHandler:   p.handleError,
+	}
+
+	upgradeTransports, err := newTransportPool(cfg.Transport, p.backends, withoutResponseHeaderTimeout, withHTTP1Only)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init upgrade transports: %w", err)
+	}
+	p.upgradeProxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		ErrorHandler: p.handleError,
+		Transport: &upgradeRoundTripper{
+			next:        upgradeTransports,
+			maxBackends: cfg.MaxBackends,
+			balancer:    p.balanver,
+			sticky:      p.sticky,
+			outlier:     p.outlier,
+			log:         p.log,
+		},
+	}
+
+	return p, nil
+}
+
+// Rewrite обоих прокси: sticky cookie и заголовки X-Forwarded-*
+func (p *ReverseProxy) rewrite(pr *httputil.ProxyRequest) {
+	p.sticky.rewrite(pr)
+	p.forwarded.rewrite(pr)
+}
+
+// Счетчики запросов, повторов и исчерпания бюджета повторов
+func (p *ReverseProxy) RetryStats() RetryStats {
+	return p.budget.stats()
+}
+
+// Ответ клиенту, если запрос не удалось проксировать.
+// gRPC клиенты получают ошибку в формате gRPC
+func (p *ReverseProxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	p.log.Error("proxy error",
 		slog.String("method", r.Method),
 		slog.String("path", r.URL.Path),
+		sl.Err(err),
 	)
 
-	proxy := httputil.ReverseProxy{
-		Director: func(request *http.Request) {
-			request.Header.Add("X-Origin-Host", request.Host)
-		},
-		Transport: transport,
+	if isGRPC(r) {
+		writeGRPCError(w, grpcErrorCode(err), err.Error())
+		return
 	}
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withClientAddr(r)
+	if isUpgrade(r) {
+		p.serveUpgrade(w, r)
+		return
+	}
+
+	p.log.Info("proxy request",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	)
 
-	proxy.ServeHTTP(w, r)
+	p.proxy.ServeHTTP(w, p.streaming.prepare(w, r))
 }
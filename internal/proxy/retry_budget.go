@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"context"
+	"loadbalancer/internal/config"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBackoffBase        = 25 * time.Millisecond
+	defaultBackoffMax         = time.Second
+	defaultBudgetRatio        = 0.2
+	defaultBudgetMinPerSecond = 3
+	defaultBudgetWindow       = 10 * time.Second
+)
+
+// Экспоненциальная задержка между попытками с full jitter
+type retryBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+func newRetryBackoff(cfg config.RetryBackoff) *retryBackoff {
+	if cfg.Base == 0 {
+		cfg.Base = defaultBackoffBase
+	}
+	if cfg.Max == 0 {
+		cfg.Max = defaultBackoffMax
+	}
+	return &retryBackoff{base: cfg.Base, max: cfg.Max}
+}
+
+// Случайная задержка от 0 до ceiling(attempt)
+func (b *retryBackoff) delay(attempt int) time.Duration {
+	return time.Duration(rand.Int63n(int64(b.ceiling(attempt)) + 1))
+}
+
+// min(max, base * 2^attempt). Сдвиг проверяется заранее, чтобы не было переполнения
+func (b *retryBackoff) ceiling(attempt int) time.Duration {
+	if attempt < 63 && b.base <= b.max>>attempt {
+		return b.base << attempt
+	}
+	return b.max
+}
+
+// Ждет перед повторной попыткой, прерывается при отмене запроса
+func (b *retryBackoff) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(b.delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Счетчики повторов
+type RetryStats struct {
+	Requests int64 `json:"requests"`
+	Retries  int64 `json:"retries"`
+	// сколько раз повтор не был выполнен из-за исчерпания бюджета
+	BudgetExhausted int64 `json:"budget_exhausted"`
+}
+
+// Общий для всех запросов бюджет повторов: в скользящем окне повторов
+// не больше ratio от запросов плюс minPerSecond в секунду.
+// Не дает повторам превратить частичный отказ бэкендов в шторм запросов
+type retryBudget struct {
+	ratio        float64
+	minPerSecond int
+	buckets      []budgetBucket
+
+	requests  atomic.Int64
+	retries   atomic.Int64
+	exhausted atomic.Int64
+
+	mu sync.Mutex
+}
+
+// Счетчики за одну секунду окна
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+func newRetryBudget(cfg config.RetryBudget) *retryBudget {
+	if cfg.Ratio == 0 {
+		cfg.Ratio = defaultBudgetRatio
+	}
+	if cfg.MinPerSecond == 0 {
+		cfg.MinPerSecond = defaultBudgetMinPerSecond
+	}
+	if cfg.Window < time.Second {
+		cfg.Window = defaultBudgetWindow
+	}
+
+	return &retryBudget{
+		ratio:        cfg.Ratio,
+		minPerSecond: cfg.MinPerSecond,
+		buckets:      make([]budgetBucket, cfg.Window/time.Second),
+	}
+}
+
+// Учитывает новый запрос от клиента
+func (b *retryBudget) request(now time.Time) {
+	b.requests.Add(1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(now).requests++
+}
+
+// Проверяет бюджет и, если он не исчерпан, учитывает повтор
+func (b *retryBudget) allowRetry(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	requests, retries := b.counts(now)
+	limit := b.ratio*float64(requests) + float64(b.minPerSecond*len(b.buckets))
+	if float64(retries) >= limit {
+		b.exhausted.Add(1)
+		return false
+	}
+
+	b.bucket(now).retries++
+	b.retries.Add(1)
+	return true
+}
+
+func (b *retryBudget) stats() RetryStats {
+	return RetryStats{
+		Requests:        b.requests.Load(),
+		Retries:         b.retries.Load(),
+		BudgetExhausted: b.exhausted.Load(),
+	}
+}
+
+// Вызывается под блокировкой b.mu
+func (b *retryBudget) bucket(now time.Time) *budgetBucket {
+	second := now.Unix()
+	bucket := &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		*bucket = budgetBucket{second: second}
+	}
+	return bucket
+}
+
+// Вызывается под блокировкой b.mu
+func (b *retryBudget) counts(now time.Time) (requests, retries int) {
+	second := now.Unix()
+	for _, bucket := range b.buckets {
+		if second-bucket.second < int64(len(b.buckets)) {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"loadbalancer/internal/config"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	RetryOnConnectError = "connect_error"
+	RetryOnAnyError     = "any_error"
+
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+var (
+	defaultRetryMethods = []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodPut,
+		http.MethodDelete,
+		http.MethodTrace,
+	}
+	defaultRetryStatusCodes = []int{
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+// Решает, можно ли повторить запрос после ошибки или ответа бэкенда
+type retryPolicy struct {
+	methods        map[string]struct{}
+	statusCodes    map[int]struct{}
+	connectOnly    bool
+	idempotencyKey bool
+	// статусы gRPC, при которых вызов повторяется
+	grpcStatusCodes map[int]struct{}
+}
+
+type routeRetryPolicy struct {
+	pathPrefix string
+	policy     *retryPolicy
+}
+
+// Общая политика и переопределения для маршрутов
+type retryPolicies struct {
+	defaultPolicy *retryPolicy
+	// отсортированы по убыванию длины префикса
+	routes []routeRetryPolicy
+}
+
+func newRetryPolicies(cfg config.Retry) (*retryPolicies, error) {
+	base := config.RetryPolicy{
+		Methods:         defaultRetryMethods,
+		StatusCodes:     defaultRetryStatusCodes,
+		On:              RetryOnAnyError,
+		IdempotencyKey:  new(bool),
+		GRPCStatusCodes: defaultRetryGRPCStatusCodes,
+	}
+	base = mergeRetryPolicy(base, cfg.RetryPolicy)
+
+	defaultPolicy, err := newRetryPolicy(base)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := &retryPolicies{defaultPolicy: defaultPolicy}
+	for _, route := range cfg.Routes {
+		policy, err := newRetryPolicy(mergeRetryPolicy(base, route.RetryPolicy))
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", route.PathPrefix, err)
+		}
+		policies.routes = append(policies.routes, routeRetryPolicy{
+			pathPrefix: route.PathPrefix,
+			policy:     policy,
+		})
+	}
+
+	sort.SliceStable(policies.routes, func(i, j int) bool {
+		return len(policies.routes[i].pathPrefix) > len(policies.routes[j].pathPrefix)
+	})
+
+	return policies, nil
+}
+
+// Переопределяет поля base заданными полями override
+func mergeRetryPolicy(base, override config.RetryPolicy) config.RetryPolicy {
+	if override.Methods != nil {
+		base.Methods = override.Methods
+	}
+	if override.StatusCodes != nil {
+		base.StatusCodes = override.StatusCodes
+	}
+	if override.On != "" {
+		base.On = override.On
+	}
+	if override.IdempotencyKey != nil {
+		base.IdempotencyKey = override.IdempotencyKey
+	}
+	if override.GRPCStatusCodes != nil {
+		base.GRPCStatusCodes = override.GRPCStatusCodes
+	}
+	return base
+}
+
+func newRetryPolicy(cfg config.RetryPolicy) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		methods:     make(map[string]struct{}, len(cfg.Methods)),
+		statusCodes: make(map[int]struct{}, len(cfg.StatusCodes)),
+
+		grpcStatusCodes: make(map[int]struct{}, len(cfg.GRPCStatusCodes)),
+	}
+
+	for _, method := range cfg.Methods {
+		policy.methods[strings.ToUpper(method)] = struct{}{}
+	}
+	for _, code := range cfg.StatusCodes {
+		policy.statusCodes[code] = struct{}{}
+	}
+	for _, code := range cfg.GRPCStatusCodes {
+		policy.grpcStatusCodes[code] = struct{}{}
+	}
+
+	switch cfg.On {
+	case RetryOnConnectError:
+		policy.connectOnly = true
+	case RetryOnAnyError:
+	default:
+		return nil, fmt.Errorf("unknown retry condition %q, expected %s or %s", cfg.On, RetryOnConnectError, RetryOnAnyError)
+	}
+
+	if cfg.IdempotencyKey != nil {
+		policy.idempotencyKey = *cfg.IdempotencyKey
+	}
+	return policy, nil
+}
+
+// Политика для запроса: маршрут с самым длинным подходящим префиксом или общая
+func (rp *retryPolicies) forRequest(r *http.Request) *retryPolicy {
+	for _, route := range rp.routes {
+		if strings.HasPrefix(r.URL.Path, route.pathPrefix) {
+			return route.policy
+		}
+	}
+	return rp.defaultPolicy
+}
+
+// Запрос можно повторять, если метод разрешен политикой,
+// либо клиент передал Idempotency-Key и политика это учитывает.
+// gRPC вызовы всегда POST, их повтор решается по статусу gRPC
+func (p *retryPolicy) requestRetryable(r *http.Request) bool {
+	if isGRPC(r) {
+		return true
+	}
+	if _, ok := p.methods[r.Method]; ok {
+		return true
+	}
+	return p.idempotencyKey && r.Header.Get(idempotencyKeyHeader) != ""
+}
+
+func (p *retryPolicy) retryableError(err error) bool {
+	if !p.connectOnly {
+		return true
+	}
+	return isConnectError(err)
+}
+
+func (p *retryPolicy) retryableStatus(code int) bool {
+	_, ok := p.statusCodes[code]
+	return ok
+}
+
+// Ответ gRPC со статусом в заголовках повторяется по статусу gRPC, остальные по коду ответа
+func (p *retryPolicy) retryableResponse(resp *http.Response) bool {
+	if code, ok := grpcStatus(resp); ok && resp.StatusCode == http.StatusOK {
+		_, ok := p.grpcStatusCodes[code]
+		return ok
+	}
+	return p.retryableStatus(resp.StatusCode)
+}
+
+// Ошибка установки соединения, запрос точно не дошел до бэкенда
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"errors"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("Default policy", func(t *testing.T) {
+		policies, err := newRetryPolicies(config.Retry{})
+		require.NoError(t, err)
+
+		get := httptest.NewRequest(http.MethodGet, "/", nil)
+		post := httptest.NewRequest(http.MethodPost, "/", nil)
+
+		assert.True(t, policies.forRequest(get).requestRetryable(get))
+		assert.False(t, policies.forRequest(post).requestRetryable(post))
+
+		policy := policies.forRequest(get)
+		assert.True(t, policy.retryableStatus(http.StatusBadGateway))
+		assert.False(t, policy.retryableStatus(http.StatusInternalServerError))
+		assert.True(t, policy.retryableError(errors.New("read timeout")))
+	})
+
+	t.Run("Idempotency key", func(t *testing.T) {
+		enabled := true
+		policies, err := newRetryPolicies(config.Retry{
+			RetryPolicy: config.RetryPolicy{IdempotencyKey: &enabled},
+		})
+		require.NoError(t, err)
+
+		post := httptest.NewRequest(http.MethodPost, "/", nil)
+		assert.False(t, policies.forRequest(post).requestRetryable(post))
+
+		post.Header.Set("Idempotency-Key", "42")
+		assert.True(t, policies.forRequest(post).requestRetryable(post))
+	})
+
+	t.Run("Route override", func(t *testing.T) {
+		policies, err := newRetryPolicies(config.Retry{
+			Routes: []config.RetryRoute{
+				{PathPrefix: "/api", RetryPolicy: config.RetryPolicy{Methods: []string{"post"}}},
+				{PathPrefix: "/api/payments", RetryPolicy: config.RetryPolicy{On: RetryOnConnectError}},
+			},
+		})
+		require.NoError(t, err)
+
+		post := httptest.NewRequest(http.MethodPost, "/api/orders", nil)
+		assert.True(t, policies.forRequest(post).requestRetryable(post))
+
+		payment := httptest.NewRequest(http.MethodGet, "/api/payments/1", nil)
+		policy := policies.forRequest(payment)
+		assert.True(t, policy.requestRetryable(payment))
+		assert.False(t, policy.retryableError(errors.New("read timeout")))
+		assert.True(t, policy.retryableError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	})
+
+	t.Run("Invalid condition", func(t *testing.T) {
+		_, err := newRetryPolicies(config.Retry{RetryPolicy: config.RetryPolicy{On: "sometimes"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Non-idempotent request is not retried", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(server.Close)
+
+		lb := balancer.NewRoundRobinBalancer(logger)
+		backend, err := balancer.NewBackend(config.Backend{URL: server.URL})
+		require.NoError(t, err)
+		lb.AddBackend(*backend)
+
+		cfg := config.Proxy{Retry: config.Retry{Backoff: config.RetryBackoff{Base: time.Millisecond, Max: time.Millisecond}}}
+		proxy, err := NewReverseProxy(lb, cfg, logger, WithCircuitBreaker())
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("charge")))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, int32(1), calls.Load())
+
+		calls.Store(0)
+		rec = httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Greater(t, calls.Load(), int32(1))
+	})
+
+	t.Run("Last attempt takes no budget and no backoff", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(server.Close)
+
+		lb := balancer.NewRoundRobinBalancer(logger)
+		backend, err := balancer.NewBackend(config.Backend{URL: server.URL})
+		require.NoError(t, err)
+		lb.AddBackend(*backend)
+
+		cfg := config.Proxy{
+			MaxRetries:  2,
+			MaxBackends: 1,
+			Retry:       config.Retry{Backoff: config.RetryBackoff{Base: 100 * time.Millisecond, Max: 100 * time.Millisecond}},
+		}
+		proxy, err := NewReverseProxy(lb, cfg, logger, WithCircuitBreaker())
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+		// из двух попыток повтор только один
+		assert.Equal(t, int64(1), proxy.RetryStats().Retries)
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Run("Backoff is bounded", func(t *testing.T) {
+		backoff := newRetryBackoff(config.RetryBackoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond})
+		for attempt := range 10 {
+			delay := backoff.delay(attempt)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, min(50*time.Millisecond, 10*time.Millisecond<<attempt))
+		}
+		assert.LessOrEqual(t, backoff.delay(100), 50*time.Millisecond)
+
+		// base * 2^attempt переполняет int64 раньше, чем достигает max
+		backoff = newRetryBackoff(config.RetryBackoff{Base: time.Hour, Max: 1000 * time.Hour})
+		assert.Equal(t, 512*time.Hour, backoff.ceiling(9))
+		for attempt := 10; attempt < 70; attempt++ {
+			assert.Equal(t, 1000*time.Hour, backoff.ceiling(attempt))
+		}
+	})
+
+	t.Run("Budget limits retries", func(t *testing.T) {
+		budget := newRetryBudget(config.RetryBudget{Ratio: 0.2, MinPerSecond: 1, Window: 2 * time.Second})
+		now := time.Now()
+
+		for range 10 {
+			budget.request(now)
+		}
+		// 0.2 * 10 запросов + 1 в секунду * 2 секунды
+		for range 4 {
+			assert.True(t, budget.allowRetry(now))
+		}
+		assert.False(t, budget.allowRetry(now))
+
+		// старые запросы и повторы выходят из окна
+		assert.True(t, budget.allowRetry(now.Add(3*time.Second)))
+
+		stats := budget.stats()
+		assert.Equal(t, int64(10), stats.Requests)
+		assert.Equal(t, int64(5), stats.Retries)
+		assert.Equal(t, int64(1), stats.BudgetExhausted)
+	})
+}
@@ -1,11 +1,19 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"loadbalancer/internal/balancer"
+	healthchecker "loadbalancer/internal/health_checker"
 	"loadbalancer/internal/lib/sl"
 	"log/slog"
 	"net/http"
+	"time"
+)
+
+var (
+	ErrCircuitOpen = errors.New("backend circuit breaker is open")
 )
 
 type retryRoundTripper struct {
@@ -13,19 +21,95 @@ type retryRoundTripper struct {
 	maxRetries  int
 	maxBackends int
 	balancer    balancer.Balancer
+	sticky      *stickySession
+	outlier     *healthchecker.OutlierDetector
+	retry       *retryPolicies
+	bodies      *bodyBuffer
+	backoff     *retryBackoff
+	budget      *retryBudget
+	streaming   *streamingPolicy
+	// ошибки учитывают circuit breaker бэкендов
+	circuitBreaker bool
 	// initBackend *balancer.Backend
 	log *slog.Logger
 }
 
 func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	var lastErr error
+	if rt.skipBuffer(req) {
+		// потоковое тело записывается по мере отправки, повтор возможен,
+		// пока записанное не превысило max_size
+		body := rt.bodies.record(req)
+		resp, err := rt.roundTrip(req, body.replayable)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		resp.Body = newTrackedBody(resp.Body, func() { body.Close() })
+		return resp, nil
+	}
 
-	for backendCount := range rt.maxBackends {
-		backend, err := rt.balancer.Next()
+	// тело запроса буферизуется, чтобы каждая попытка отправляла его целиком
+	body, err := rt.bodies.buffer(req)
+	if err != nil {
+		rt.log.Error("failed to buffer request body", sl.Err(err))
+		return nil, err
+	}
+	if body == nil {
+		rt.log.Debug("request body exceeds buffer limit, retries disabled",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+		)
+		streamed, _ := req.Body.(*streamedBody)
+		resp, err := rt.roundTrip(req, neverReplayable)
+		if streamed == nil {
+			return resp, err
+		}
+		// транспорт мог не получить тело, временный файл удаляется в любом случае
 		if err != nil {
-			rt.log.Error("failed to get backend", sl.Err(err))
+			streamed.Close()
 			return nil, err
 		}
+		resp.Body = newTrackedBody(resp.Body, func() { streamed.Close() })
+		return resp, nil
+	}
+
+	resp, err := rt.roundTrip(req, alwaysReplayable)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	// временный файл нужен, пока транспорт может дописывать тело запроса
+	resp.Body = newTrackedBody(resp.Body, func() { body.Close() })
+	return resp, nil
+}
+
+func (rt *retryRoundTripper) roundTrip(req *http.Request, replayable func() bool) (*http.Response, error) {
+	var lastErr error
+	// кол-во выполненных повторов, от него растет задержка
+	retries := 0
+
+	rt.budget.request(time.Now())
+
+	// первая попытка идет на бэкенд из sticky cookie, если он доступен
+	pinned := rt.sticky.pinnedBackend(req)
+	if pinned != nil && !usedBackends(req.Context()).claim(pinned) {
+		pinned = nil
+	}
+
+	policy := rt.retry.forRequest(req)
+	canRetry := policy.requestRetryable(req)
+	grpc := isGRPC(req)
+
+	for backendCount := range rt.maxBackends {
+		backend := pinned
+		if backendCount > 0 || backend == nil {
+			var err error
+			backend, err = rt.nextBackend(req)
+			if err != nil {
+				rt.log.Error("failed to get backend", sl.Err(err))
+				return nil, err
+			}
+		}
 
 		rt.log.Debug("selected backend",
 			slog.String("backendURL", backend.URL.String()),
@@ -33,23 +117,46 @@ func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error
 		)
 
 		for retryBackend := range rt.maxRetries {
+			if !backend.AllowRequest() {
+				rt.log.Debug("circuit breaker rejected request",
+					slog.String("backendURL", backend.URL.String()),
+					slog.String("state", backend.CircuitState().String()),
+				)
+				lastErr = ErrCircuitOpen
+				break
+			}
+
 			reqCopy := req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("failed to replay request body: %w", err)
+				}
+				reqCopy.Body = body
+			}
 
 			reqCopy.URL.Scheme = backend.URL.Scheme
 			reqCopy.URL.Host = backend.URL.Host
 
-			reqCopy.Header.Add("X-Forwarded-Host", req.Host)
-			// reqCopy.Header.Add("X-Origin-Host", backend.URL.Host)
-
 			rt.log.Debug("trying backend",
 				slog.String("backendURL", backend.URL.String()),
 				slog.Int("backendCount", backendCount+1),
 				slog.Int("retryBackend", retryBackend+1),
 			)
 
-			resp, err := rt.next.RoundTrip(reqCopy)
+			resp, err := sendToBackend(rt.next, backend, reqCopy, rt.outlier)
+			// запрос отменил клиент или выигравшая попытка хеджирования,
+			// это не ошибка бэкенда и не повод для повтора
+			if err != nil && requestCanceled(req, err) {
+				backend.ReportCanceled()
+				return nil, err
+			}
 
-			if err == nil && resp.StatusCode < 500 {
+			if err == nil && backendStatus(resp) < 500 {
+				backend.ReportSuccess()
+				if rt.sticky != nil && backend != pinned {
+					resp.Header.Add("Set-Cookie", rt.sticky.cookie(backend).String())
+				}
 				return resp, nil
 			}
 
@@ -64,18 +171,70 @@ func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error
 			} else {
 				rt.log.Error("backend returned error",
 					slog.String("backendURL", backend.URL.String()),
-					slog.Int("status", resp.StatusCode),
+					slog.Int("status", backendStatus(resp)),
 					slog.Int("backendCount", backendCount+1),
 					slog.Int("retryBackend", retryBackend+1),
 				)
+			}
+
+			if opened := backend.ReportFailure(); opened {
+				rt.log.Warn("circuit breaker opened",
+					slog.String("backendURL", backend.URL.String()),
+				)
+			}
+
+			retryable := canRetry && replayable()
+			if err != nil {
+				retryable = retryable && policy.retryableError(err)
+				// gRPC вызов мог дойти до сервиса, повторяется только если соединение не установлено
+				if grpc {
+					retryable = retryable && isConnectError(err)
+				}
+			} else {
+				retryable = retryable && policy.retryableResponse(resp)
+			}
+
+			// после последней попытки на последнем бэкенде повтора уже не будет
+			lastAttempt := backendCount == rt.maxBackends-1 && retryBackend == rt.maxRetries-1
+			if retryable && !lastAttempt && !rt.budget.allowRetry(time.Now()) {
+				rt.log.Warn("retry budget exhausted",
+					slog.String("method", req.Method),
+					slog.String("path", req.URL.Path),
+				)
+				retryable = false
+			}
+
+			// неповторяемый запрос отдается клиенту как есть
+			if !retryable {
+				rt.log.Debug("request is not retryable",
+					slog.String("method", req.Method),
+					slog.String("path", req.URL.Path),
+				)
+				if err != nil {
+					return nil, err
+				}
+				return resp, nil
+			}
+
+			if resp != nil {
 				resp.Body.Close()
 			}
-			if retryBackend == rt.maxRetries-1 {
+
+			// с outlier detection и circuit breaker бэкенд исключается по статистике ответов
+			if rt.outlier == nil && !rt.circuitBreaker && retryBackend == rt.maxRetries-1 {
 				rt.log.Warn("marking backend as down",
 					slog.String("backendURL", backend.URL.String()),
 				)
 				rt.balancer.MarkAsDown(backend)
 			}
+
+			if lastAttempt {
+				break
+			}
+			if err := rt.backoff.wait(req.Context(), retries); err != nil {
+				return nil, err
+			}
+			retries++
 		}
 	}
 	if lastErr != nil {
@@ -83,3 +242,61 @@ func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error
 	}
 	return nil, fmt.Errorf("all backends failed")
 }
+
+func alwaysReplayable() bool { return true }
+
+func neverReplayable() bool { return false }
+
+// Тело потоковых вызовов не буферизуется заранее: клиент gRPC стрима или
+// потокового маршрута может ждать ответа, не закончив отправку тела
+func (rt *retryRoundTripper) skipBuffer(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	return isGRPC(req) || rt.streaming.route(req) || (req.ProtoMajor == 2 && req.ContentLength == -1)
+}
+
+// Отправляет запрос на бэкенд: учитывает соединение до закрытия тела ответа,
+// время ответа и результат для outlier detection
+func sendToBackend(next http.RoundTripper, backend *balancer.Backend, req *http.Request, outlier *healthchecker.OutlierDetector) (*http.Response, error) {
+	backend.IncConnections()
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		backend.DecConnections()
+		if !requestCanceled(req, err) {
+			backend.ObserveFailure()
+			outlier.Report(backend, 0, err)
+		}
+		return nil, err
+	}
+
+	// время до получения заголовков ответа, ошибки учитываются штрафом
+	if backendStatus(resp) >= 500 {
+		backend.ObserveFailure()
+	} else {
+		backend.ObserveLatency(time.Since(start))
+	}
+	resp.Body = newTrackedBody(resp.Body, backend.DecConnections)
+	outlier.Report(backend, backendStatus(resp), nil)
+	return resp, nil
+}
+
+func requestCanceled(req *http.Request, err error) bool {
+	return req.Context().Err() != nil || errors.Is(err, context.Canceled)
+}
+
+// Выбирает бэкенд, на который еще не ушли другие попытки хеджированного запроса
+func (rt *retryRoundTripper) nextBackend(req *http.Request) (*balancer.Backend, error) {
+	used := usedBackends(req.Context())
+	for range rt.maxBackends {
+		backend, err := rt.balancer.Next(req)
+		if err != nil {
+			return nil, err
+		}
+		if used.claim(backend) {
+			return backend, nil
+		}
+	}
+	return nil, ErrNoFreeBackend
+}
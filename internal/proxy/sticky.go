@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStickyCookieName = "lb_backend"
+	// байт HMAC в идентификаторе бэкенда
+	stickyIDSize = 16
+)
+
+// Sticky sessions: в cookie хранится идентификатор выбранного бэкенда,
+// по которому нельзя узнать его адрес или выбрать другой бэкенд
+type stickySession struct {
+	cookieName string
+	secret     []byte
+	ttl        time.Duration
+	balancer   balancer.Balancer
+}
+
+func newStickySession(cfg config.StickySession, b balancer.Balancer) (*stickySession, error) {
+	if cfg.CookieName == "" {
+		cfg.CookieName = defaultStickyCookieName
+	}
+
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		// без заданного ключа cookie перестанут быть валидными после перезапуска
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &stickySession{
+		cookieName: cfg.CookieName,
+		secret:     secret,
+		ttl:        cfg.TTL,
+		balancer:   b,
+	}, nil
+}
+
+type pinnedBackendKey struct{}
+
+// Rewrite для httputil.ReverseProxy: бэкенд из cookie сохраняется в контексте
+// запроса, сама cookie бэкенду не передается
+func (s *stickySession) rewrite(pr *httputil.ProxyRequest) {
+	if s == nil {
+		return
+	}
+
+	if backend := s.cookieBackend(pr.In); backend != nil {
+		pr.Out = pr.Out.WithContext(context.WithValue(pr.Out.Context(), pinnedBackendKey{}, backend))
+	}
+	s.removeCookie(pr.Out.Header)
+}
+
+// Возвращает бэкенд, к которому привязан клиент.
+// nil если cookie нет, она неверна, бэкенд удален или недоступен
+func (s *stickySession) pinnedBackend(r *http.Request) *balancer.Backend {
+	backend, _ := r.Context().Value(pinnedBackendKey{}).(*balancer.Backend)
+	if backend == nil || backend.IsDown() {
+		return nil
+	}
+	return backend
+}
+
+func (s *stickySession) cookieBackend(r *http.Request) *balancer.Backend {
+	cookie, err := r.Cookie(s.cookieName)
+	if err != nil {
+		return nil
+	}
+
+	for _, backend := range s.balancer.GetAllBackends() {
+		if hmac.Equal([]byte(cookie.Value), []byte(s.backendID(backend))) {
+			return backend
+		}
+	}
+	return nil
+}
+
+// Удаляет sticky cookie из заголовков Cookie, остальные cookie не меняются
+func (s *stickySession) removeCookie(h http.Header) {
+	lines := h.Values("Cookie")
+	if len(lines) == 0 {
+		return
+	}
+
+	var kept []string
+	for _, line := range lines {
+		for part := range strings.SplitSeq(line, ";") {
+			part = strings.TrimSpace(part)
+			if name, _, _ := strings.Cut(part, "="); part != "" && name != s.cookieName {
+				kept = append(kept, part)
+			}
+		}
+	}
+
+	h.Del("Cookie")
+	if len(kept) > 0 {
+		h.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
+// Cookie, привязывающая клиента к бэкенду
+func (s *stickySession) cookie(backend *balancer.Backend) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     s.cookieName,
+		Value:    s.backendID(backend),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.ttl > 0 {
+		cookie.MaxAge = int(s.ttl.Seconds())
+	}
+	return cookie
+}
+
+// Непрозрачный идентификатор бэкенда: обрезанный HMAC от url.
+// Клиент не видит адрес бэкенда и не может подобрать идентификатор другого
+func (s *stickySession) backendID(backend *balancer.Backend) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(backend.URL.String()))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:stickyIDSize])
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStickySession(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	newBackendServer := func(t *testing.T, name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	newBalancer := func(t *testing.T, servers ...*httptest.Server) balancer.Balancer {
+		lb := balancer.NewRoundRobinBalancer(logger)
+		for _, server := range servers {
+			backend, err := balancer.NewBackend(config.Backend{URL: server.URL})
+			require.NoError(t, err)
+			lb.AddBackend(*backend)
+		}
+		return lb
+	}
+
+	t.Run("Backend id is opaque", func(t *testing.T) {
+		lb := newBalancer(t, newBackendServer(t, "one"))
+		backend := lb.GetAllBackends()[0]
+
+		s, err := newStickySession(config.StickySession{Secret: "secret"}, lb)
+		require.NoError(t, err)
+		cookie := s.cookie(backend)
+		assert.NotContains(t, cookie.Value, backend.URL.Host)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		assert.Equal(t, backend, s.cookieBackend(req))
+
+		other, err := newStickySession(config.StickySession{Secret: "other"}, lb)
+		require.NoError(t, err)
+		assert.Nil(t, other.cookieBackend(req))
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: defaultStickyCookieName, Value: "garbage"})
+		assert.Nil(t, s.cookieBackend(req))
+	})
+
+	t.Run("Sticky cookie is not sent to backend", func(t *testing.T) {
+		var received []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Values("Cookie")
+		}))
+		t.Cleanup(server.Close)
+
+		lb := newBalancer(t, server)
+		cfg := config.Proxy{StickySession: config.StickySession{Enabled: true, Secret: "secret"}}
+		proxy, err := NewReverseProxy(lb, cfg, logger)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		pinned := defaultStickyCookieName + "=" + proxy.sticky.backendID(lb.GetAllBackends()[0])
+		req.Header.Set("Cookie", "session=abc; "+pinned+"; theme=dark")
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		assert.Equal(t, []string{"session=abc; theme=dark"}, received)
+		// клиент уже привязан к этому бэкенду
+		assert.Empty(t, rec.Result().Cookies())
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(proxy.sticky.cookie(lb.GetAllBackends()[0]))
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Empty(t, received)
+	})
+
+	t.Run("Client stays on pinned backend", func(t *testing.T) {
+		lb := newBalancer(t, newBackendServer(t, "one"), newBackendServer(t, "two"))
+		cfg := config.Proxy{StickySession: config.StickySession{Enabled: true, Secret: "secret"}}
+		proxy, err := NewReverseProxy(lb, cfg, logger)
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		first := rec.Body.String()
+
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+
+		for i := 0; i < 5; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(cookies[0])
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			assert.Equal(t, first, rec.Body.String())
+			assert.Empty(t, rec.Result().Cookies())
+		}
+	})
+
+	t.Run("Re-pin when pinned backend is down", func(t *testing.T) {
+		lb := newBalancer(t, newBackendServer(t, "one"), newBackendServer(t, "two"))
+		cfg := config.Proxy{StickySession: config.StickySession{Enabled: true, Secret: "secret"}}
+		proxy, err := NewReverseProxy(lb, cfg, logger)
+		require.NoError(t, err)
+
+		pinned := lb.GetAllBackends()[0]
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(proxy.sticky.cookie(pinned))
+
+		pinned.SetHealth(true)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		assert.Equal(t, "two", rec.Body.String())
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+
+		assert.Equal(t, proxy.sticky.backendID(lb.GetAllBackends()[1]), cookies[0].Value)
+	})
+}
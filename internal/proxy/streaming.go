@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"loadbalancer/internal/config"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStreamIdleTimeout = 5 * time.Minute
+)
+
+var defaultStreamingContentTypes = []string{
+	"text/event-stream",
+	"application/x-ndjson",
+	"application/grpc",
+	"application/grpc+proto",
+}
+
+type responseControllerKey struct{}
+
+// Определяет потоковые ответы по типу содержимого или маршруту
+type streamingPolicy struct {
+	contentTypes []string
+	pathPrefixes []string
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+}
+
+func newStreamingPolicy(cfg config.Streaming) *streamingPolicy {
+	if cfg.ContentTypes == nil {
+		cfg.ContentTypes = defaultStreamingContentTypes
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = defaultStreamIdleTimeout
+	}
+
+	policy := &streamingPolicy{
+		pathPrefixes: cfg.PathPrefixes,
+		writeTimeout: cfg.WriteTimeout,
+		idleTimeout:  cfg.IdleTimeout,
+	}
+	for _, contentType := range cfg.ContentTypes {
+		policy.contentTypes = append(policy.contentTypes, strings.ToLower(contentType))
+	}
+	return policy
+}
+
+func (sp *streamingPolicy) route(r *http.Request) bool {
+	return slices.ContainsFunc(sp.pathPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	})
+}
+
+func (sp *streamingPolicy) contentType(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return slices.Contains(sp.contentTypes, mediaType)
+}
+
+// Сохраняет в контексте запроса доступ к соединению клиента,
+// чтобы снять таймауты, когда ответ окажется потоковым
+func (sp *streamingPolicy) prepare(w http.ResponseWriter, r *http.Request) *http.Request {
+	rc := http.NewResponseController(w)
+	if sp.route(r) {
+		sp.extendDeadlines(rc)
+	}
+	return r.WithContext(context.WithValue(r.Context(), responseControllerKey{}, rc))
+}
+
+// Заменяет общие ReadTimeout и WriteTimeout сервера на таймаут потока
+func (sp *streamingPolicy) extendDeadlines(rc *http.ResponseController) {
+	var deadline time.Time
+	if sp.writeTimeout > 0 {
+		deadline = time.Now().Add(sp.writeTimeout)
+	}
+	// ошибки означают, что ResponseWriter не поддерживает таймауты
+	rc.SetWriteDeadline(deadline)
+	rc.SetReadDeadline(time.Time{})
+}
+
+// ModifyResponse для httputil.ReverseProxy: потоковый ответ отдается клиенту
+// без буферизации и закрывается, если бэкенд долго не присылает данных
+func (sp *streamingPolicy) modifyResponse(resp *http.Response) error {
+	if !sp.route(resp.Request) && !sp.contentType(resp.Header) {
+		return nil
+	}
+
+	// httputil.ReverseProxy сбрасывает ответ неизвестной длины после каждой записи
+	resp.ContentLength = -1
+	if rc, ok := resp.Request.Context().Value(responseControllerKey{}).(*http.ResponseController); ok {
+		sp.extendDeadlines(rc)
+	}
+	resp.Body = newIdleTimeoutBody(resp.Body, sp.idleTimeout)
+	return nil
+}
+
+// Запросы к потоковым маршрутам отправляются через транспорт без таймаута
+// ожидания заголовков ответа: бэкенд может не отвечать до первого события
+type streamingTransport struct {
+	policy  *streamingPolicy
+	next    http.RoundTripper
+	streams http.RoundTripper
+}
+
+func (st *streamingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if st.policy.route(req) {
+		return st.streams.RoundTrip(req)
+	}
+	return st.next.RoundTrip(req)
+}
+
+// Тело ответа, которое закрывается, если из него не читаются данные дольше timeout
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	once    sync.Once
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration) *idleTimeoutBody {
+	b := &idleTimeoutBody{
+		ReadCloser: body,
+		timeout:    timeout,
+	}
+	b.timer = time.AfterFunc(timeout, func() { b.Close() })
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		b.timer.Stop()
+		err = b.ReadCloser.Close()
+	})
+	return err
+}
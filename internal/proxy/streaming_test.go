@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreaming(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	// прокси за сервером с коротким общим WriteTimeout
+	newFront := func(t *testing.T, cfg config.Proxy, handler http.HandlerFunc) *httptest.Server {
+		backendServer := httptest.NewServer(handler)
+		t.Cleanup(backendServer.Close)
+
+		lb := balancer.NewRoundRobinBalancer(logger)
+		backend, err := balancer.NewBackend(config.Backend{URL: backendServer.URL})
+		require.NoError(t, err)
+		lb.AddBackend(*backend)
+
+		proxy, err := NewReverseProxy(lb, cfg, logger)
+		require.NoError(t, err)
+
+		front := httptest.NewUnstartedServer(proxy)
+		front.Config.ReadTimeout = 150 * time.Millisecond
+		front.Config.WriteTimeout = 150 * time.Millisecond
+		front.Start()
+		t.Cleanup(front.Close)
+		return front
+	}
+
+	events := func(contentType string, count int, pause time.Duration) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			for i := range count {
+				fmt.Fprintf(w, "data: %d\n\n", i)
+				w.(http.Flusher).Flush()
+				select {
+				case <-time.After(pause):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+	}
+
+	t.Run("SSE outlives server write timeout", func(t *testing.T) {
+		front := newFront(t, config.Proxy{}, events("text/event-stream", 5, 80*time.Millisecond))
+
+		resp, err := http.Get(front.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		reader := bufio.NewReader(resp.Body)
+		start := time.Now()
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "data: 0\n", line)
+		assert.Less(t, time.Since(start), 80*time.Millisecond)
+
+		rest, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Contains(t, string(rest), "data: 4")
+	})
+
+	t.Run("Streaming route", func(t *testing.T) {
+		cfg := config.Streaming{PathPrefixes: []string{"/feed"}}
+		front := newFront(t, config.Proxy{Streaming: cfg}, events("application/json", 4, 80*time.Millisecond))
+
+		resp, err := http.Get(front.URL + "/feed")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "data: 3")
+	})
+
+	t.Run("Streaming route waits for headers without timeout", func(t *testing.T) {
+		cfg := config.Proxy{
+			MaxRetries:  1,
+			MaxBackends: 1,
+			Transport:   config.Transport{ResponseHeaderTimeout: 30 * time.Millisecond},
+			Streaming:   config.Streaming{PathPrefixes: []string{"/feed"}},
+		}
+		front := newFront(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(80 * time.Millisecond)
+			events("text/event-stream", 1, 0)(w, r)
+		})
+
+		resp, err := http.Get(front.URL + "/feed")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "data: 0\n\n", string(body))
+
+		resp, err = http.Get(front.URL + "/orders")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	})
+
+	t.Run("Idle stream is closed", func(t *testing.T) {
+		cfg := config.Streaming{IdleTimeout: 100 * time.Millisecond}
+		front := newFront(t, config.Proxy{Streaming: cfg}, events("text/event-stream", 2, 2*time.Second))
+
+		resp, err := http.Get(front.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		start := time.Now()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "data: 0\n\n", string(body))
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
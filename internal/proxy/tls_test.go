@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Сертификат для commonName, подписанный parent, или CA, если parent nil
+func issueCertificate(t *testing.T, commonName string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, any(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, path, blockType string, data []byte) string {
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0o600))
+	return path
+}
+
+func TestBackendTLS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+	dir := t.TempDir()
+
+	clientCA := issueCertificate(t, "clients", nil)
+	client := issueCertificate(t, "balancer", &clientCA)
+	keyDER, err := x509.MarshalECPrivateKey(client.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	certFile := writePEM(t, filepath.Join(dir, "client.crt"), "CERTIFICATE", client.Certificate[0])
+	keyFile := writePEM(t, filepath.Join(dir, "client.key"), "EC PRIVATE KEY", keyDER)
+
+	// бэкенд требует сертификат клиента и отвечает его CN и протоколом
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.Leaf)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.TLS.PeerCertificates[0].Subject.CommonName, r.Proto)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	caFile := writePEM(t, filepath.Join(dir, "backend-ca.crt"), "CERTIFICATE", server.Certificate().Raw)
+
+	send := func(t *testing.T, backendCfg config.Backend) *httptest.ResponseRecorder {
+		lb := balancer.NewRoundRobinBalancer(logger)
+		backend, err := balancer.NewBackend(backendCfg)
+		require.NoError(t, err)
+		lb.AddBackend(*backend)
+
+		cfg := config.Proxy{MaxRetries: 1, MaxBackends: 1}
+		proxy, err := NewReverseProxy(lb, cfg, logger, WithCircuitBreaker(), WithBackends([]config.Backend{backendCfg}))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	t.Run("Client certificate and CA", func(t *testing.T) {
+		rec := send(t, config.Backend{
+			URL: server.URL,
+			TLS: config.BackendTLS{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "balancer HTTP/1.1", rec.Body.String())
+	})
+
+	t.Run("h2 with client certificate", func(t *testing.T) {
+		rec := send(t, config.Backend{
+			URL:      server.URL,
+			Protocol: balancer.ProtocolH2,
+			TLS:      config.BackendTLS{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+		})
+		assert.Equal(t, "balancer HTTP/2.0", rec.Body.String())
+	})
+
+	t.Run("Server name override", func(t *testing.T) {
+		// сертификат httptest выдан на example.com
+		rec := send(t, config.Backend{
+			URL: server.URL,
+			TLS: config.BackendTLS{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "example.com"},
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = send(t, config.Backend{
+			URL: server.URL,
+			TLS: config.BackendTLS{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "other.com"},
+		})
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+	})
+
+	t.Run("Without client certificate", func(t *testing.T) {
+		rec := send(t, config.Backend{URL: server.URL, TLS: config.BackendTLS{CAFile: caFile}})
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+	})
+
+	t.Run("Insecure skip verify", func(t *testing.T) {
+		rec := send(t, config.Backend{
+			URL: server.URL,
+			TLS: config.BackendTLS{CertFile: certFile, KeyFile: keyFile, InsecureSkipVerify: true},
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := balancer.NewBackend(config.Backend{URL: server.URL, TLS: config.BackendTLS{CertFile: certFile}})
+		assert.ErrorIs(t, err, balancer.ErrClientCertPartial)
+
+		_, err = balancer.NewBackend(config.Backend{URL: server.URL, TLS: config.BackendTLS{CAFile: keyFile}})
+		assert.ErrorIs(t, err, balancer.ErrInvalidCA)
+	})
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// Тело ответа, которое вызывает onClose ровно один раз при закрытии.
+// Используется для учета запросов в обработке на бэкенде
+type trackedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	onClose func()
+}
+
+func newTrackedBody(body io.ReadCloser, onClose func()) *trackedBody {
+	return &trackedBody{
+		ReadCloser: body,
+		onClose:    onClose,
+	}
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+// httputil.ReverseProxy при Upgrade ожидает, что тело ответа реализует io.ReadWriteCloser
+func (b *trackedBody) Write(p []byte) (int, error) {
+	w, ok := b.ReadCloser.(io.Writer)
+	if !ok {
+		return 0, errors.New("response body is not writable")
+	}
+	return w.Write(p)
+}
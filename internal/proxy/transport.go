@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/proxyproto"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+)
+
+var defaultTransportConfig = config.Transport{
+	DialTimeout:           5 * time.Second,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ResponseHeaderTimeout: 2 * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+}
+
+// Транспорты бэкендов: общий и отдельные для бэкендов со своими настройками.
+// Транспорт выбирается по схеме и хосту запроса
+type transportPool struct {
+	shared   http.RoundTripper
+	backends map[string]http.RoundTripper
+}
+
+// Изменяет созданный по конфигу транспорт
+type transportOption func(*http.Transport)
+
+// Без таймаута ожидания заголовков ответа, для долгоживущих соединений
+func withoutResponseHeaderTimeout(t *http.Transport) {
+	t.ResponseHeaderTimeout = 0
+}
+
+// Только HTTP/1, Upgrade не поддерживается в HTTP/2
+func withHTTP1Only(t *http.Transport) {
+	t.Protocols = &http.Protocols{}
+	t.Protocols.SetHTTP1(true)
+}
+
+// Соединение с бэкендом начинается с PROXY заголовка с адресом клиента.
+// Соединение принадлежит одному клиенту, поэтому не переиспользуется
+func withProxyProtocol(version string) transportOption {
+	return func(t *http.Transport) {
+		t.DisableKeepAlives = true
+		t.DialContext = proxyproto.DialWithHeader(t.DialContext, func(ctx context.Context, conn net.Conn) ([]byte, error) {
+			source, ok := ctx.Value(clientAddrKey{}).(netip.AddrPort)
+			if !ok {
+				return proxyproto.FormatLocal(version)
+			}
+			// адрес, к которому подключился клиент
+			destination := proxyproto.AddrPort(conn.RemoteAddr())
+			if local, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr); ok {
+				destination = proxyproto.AddrPort(local)
+			}
+			return proxyproto.Format(version, source, destination)
+		})
+	}
+}
+
+// Адрес клиента для PROXY заголовка к бэкендам
+type clientAddrKey struct{}
+
+func withClientAddr(r *http.Request) *http.Request {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientAddrKey{}, addr))
+}
+
+func newTransportPool(cfg config.Transport, backends []config.Backend, opts ...transportOption) (*transportPool, error) {
+	build := func(cfg config.Transport, backend config.Backend) (http.RoundTripper, error) {
+		protocols, err := balancer.HTTPProtocols(backend.Protocol)
+		if err != nil {
+			return nil, err
+		}
+		if !proxyproto.ValidVersion(backend.ProxyProtocol) {
+			return nil, fmt.Errorf("%w: %q", balancer.ErrUnknownProxyProtocol, backend.ProxyProtocol)
+		}
+		tlsConfig, err := balancer.TLSClientConfig(backend.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		transport := newTransport(cfg, protocols)
+		transport.TLSClientConfig = tlsConfig
+		for _, opt := range opts {
+			opt(transport)
+		}
+		if backend.ProxyProtocol != "" {
+			withProxyProtocol(backend.ProxyProtocol)(transport)
+		}
+		return transport, nil
+	}
+
+	base := mergeTransport(defaultTransportConfig, cfg)
+	shared, err := build(base, config.Backend{})
+	if err != nil {
+		return nil, err
+	}
+	pool := &transportPool{
+		shared:   shared,
+		backends: make(map[string]http.RoundTripper),
+	}
+
+	for _, backend := range backends {
+		if backend.Transport == (config.Transport{}) && backend.Protocol == "" && backend.ProxyProtocol == "" && backend.TLS == (config.BackendTLS{}) {
+			continue
+		}
+		u, err := url.Parse(backend.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend url %q: %w", backend.URL, err)
+		}
+		transport, err := build(mergeTransport(base, backend.Transport), backend)
+		if err != nil {
+			return nil, fmt.Errorf("backend %q: %w", backend.URL, err)
+		}
+		pool.backends[transportKey(u)] = transport
+	}
+
+	return pool, nil
+}
+
+func (tp *transportPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := tp.backends[transportKey(req.URL)]; ok {
+		return transport.RoundTrip(req)
+	}
+	return tp.shared.RoundTrip(req)
+}
+
+func transportKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// Переопределяет поля base заданными полями override
+func mergeTransport(base, override config.Transport) config.Transport {
+	if override.DialTimeout != 0 {
+		base.DialTimeout = override.DialTimeout
+	}
+	if override.TLSHandshakeTimeout != 0 {
+		base.TLSHandshakeTimeout = override.TLSHandshakeTimeout
+	}
+	if override.ResponseHeaderTimeout != 0 {
+		base.ResponseHeaderTimeout = override.ResponseHeaderTimeout
+	}
+	if override.IdleConnTimeout != 0 {
+		base.IdleConnTimeout = override.IdleConnTimeout
+	}
+	if override.MaxIdleConns != 0 {
+		base.MaxIdleConns = override.MaxIdleConns
+	}
+	if override.MaxIdleConnsPerHost != 0 {
+		base.MaxIdleConnsPerHost = override.MaxIdleConnsPerHost
+	}
+	return base
+}
+
+func newTransport(cfg config.Transport, protocols *http.Protocols) *http.Transport {
+	return &http.Transport{
+		Protocols:             protocols,
+		DialContext:           (&net.Dialer{Timeout: cfg.DialTimeout}).DialContext,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+	}
+}
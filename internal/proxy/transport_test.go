@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/proxyproto"
+	"loadbalancer/internal/lib/trustedproxy"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportPool(t *testing.T) {
+	t.Run("Backend overrides shared settings", func(t *testing.T) {
+		base := config.Transport{DialTimeout: time.Second, MaxIdleConns: 50}
+		merged := mergeTransport(mergeTransport(defaultTransportConfig, base), config.Transport{MaxIdleConns: 5})
+
+		assert.Equal(t, time.Second, merged.DialTimeout)
+		assert.Equal(t, 5, merged.MaxIdleConns)
+		assert.Equal(t, defaultTransportConfig.ResponseHeaderTimeout, merged.ResponseHeaderTimeout)
+	})
+
+	t.Run("Per-backend response header timeout", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("ok"))
+		}))
+		t.Cleanup(server.Close)
+
+		newProxy := func(t *testing.T, backendCfg config.Backend) *ReverseProxy {
+			lb := balancer.NewRoundRobinBalancer(logger)
+			backend, err := balancer.NewBackend(backendCfg)
+			require.NoError(t, err)
+			lb.AddBackend(*backend)
+
+			cfg := config.Proxy{MaxRetries: 1, MaxBackends: 1}
+			proxy, err := NewReverseProxy(lb, cfg, logger, WithCircuitBreaker(), WithBackends([]config.Backend{backendCfg}))
+			require.NoError(t, err)
+			return proxy
+		}
+
+		proxy := newProxy(t, config.Backend{URL: server.URL})
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		proxy = newProxy(t, config.Backend{
+			URL:       server.URL,
+			Transport: config.Transport{ResponseHeaderTimeout: 10 * time.Millisecond},
+		})
+		rec = httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+	})
+
+	t.Run("h2c backend", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}))
+		server.Config.Protocols = &http.Protocols{}
+		server.Config.Protocols.SetHTTP1(true)
+		server.Config.Protocols.SetUnencryptedHTTP2(true)
+		server.Start()
+		t.Cleanup(server.Close)
+
+		for protocol, expected := range map[string]string{
+			balancer.ProtocolHTTP1: "HTTP/1.1",
+			balancer.ProtocolH2C:   "HTTP/2.0",
+		} {
+			backendCfg := config.Backend{URL: server.URL, Protocol: protocol}
+			lb := balancer.NewRoundRobinBalancer(logger)
+			backend, err := balancer.NewBackend(backendCfg)
+			require.NoError(t, err)
+			lb.AddBackend(*backend)
+
+			proxy, err := NewReverseProxy(lb, config.Proxy{}, logger, WithBackends([]config.Backend{backendCfg}))
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, expected, rec.Body.String(), protocol)
+		}
+	})
+
+	t.Run("PROXY protocol backend", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+		trusted, err := trustedproxy.New([]string{"127.0.0.1"})
+		require.NoError(t, err)
+
+		// бэкенд отвечает адресом клиента из PROXY заголовка
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.RemoteAddr))
+		}))
+		server.Listener = proxyproto.NewListener(server.Listener, trusted, time.Second)
+		server.Start()
+		t.Cleanup(server.Close)
+
+		for _, version := range []string{proxyproto.V1, proxyproto.V2} {
+			backendCfg := config.Backend{URL: server.URL, ProxyProtocol: version}
+			lb := balancer.NewRoundRobinBalancer(logger)
+			backend, err := balancer.NewBackend(backendCfg)
+			require.NoError(t, err)
+			lb.AddBackend(*backend)
+
+			proxy, err := NewReverseProxy(lb, config.Proxy{}, logger, WithBackends([]config.Backend{backendCfg}))
+			require.NoError(t, err)
+
+			for _, client := range []string{"203.0.113.9:4000", "198.51.100.4:5000"} {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = client
+
+				rec := httptest.NewRecorder()
+				proxy.ServeHTTP(rec, req)
+				// соединения не переиспользуются между клиентами
+				assert.Equal(t, client, rec.Body.String(), version)
+			}
+		}
+	})
+
+	t.Run("PROXY protocol requires http1", func(t *testing.T) {
+		_, err := balancer.NewBackend(config.Backend{URL: "http://localhost:1", Protocol: balancer.ProtocolH2C, ProxyProtocol: proxyproto.V2})
+		assert.ErrorIs(t, err, balancer.ErrProxyProtocolHTTP2)
+
+		_, err = balancer.NewBackend(config.Backend{URL: "http://localhost:1", ProxyProtocol: "v3"})
+		assert.ErrorIs(t, err, balancer.ErrUnknownProxyProtocol)
+	})
+
+	t.Run("Unknown protocol", func(t *testing.T) {
+		_, err := newTransportPool(config.Transport{}, []config.Backend{{URL: "http://localhost:1", Protocol: "spdy"}})
+		assert.ErrorIs(t, err, balancer.ErrUnknownProtocol)
+	})
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"loadbalancer/internal/balancer"
+	healthchecker "loadbalancer/internal/health_checker"
+	"loadbalancer/internal/lib/sl"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrTunnelsClosed = errors.New("proxy is shutting down, upgrade rejected")
+)
+
+// Запрос на смену протокола (WebSocket и другие Upgrade)
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Отправляет Upgrade запрос на один бэкенд. Повтор возможен только если
+// соединение с бэкендом не установлено, после рукопожатия запрос не повторяется.
+// Соединение учитывается на бэкенде, пока открыт туннель
+type upgradeRoundTripper struct {
+	next        http.RoundTripper
+	maxBackends int
+	balancer    balancer.Balancer
+	sticky      *stickySession
+	outlier     *healthchecker.OutlierDetector
+	log         *slog.Logger
+}
+
+func (ut *upgradeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	pinned := ut.sticky.pinnedBackend(req)
+
+	var lastErr error
+	for attempt := range ut.maxBackends {
+		backend := pinned
+		if attempt > 0 || backend == nil {
+			var err error
+			backend, err = ut.balancer.Next(req)
+			if err != nil {
+				ut.log.Error("failed to get backend for upgrade", sl.Err(err))
+				return nil, err
+			}
+		}
+
+		if !backend.AllowRequest() {
+			lastErr = ErrCircuitOpen
+			continue
+		}
+
+		reqCopy := req.Clone(req.Context())
+		reqCopy.URL.Scheme = backend.URL.Scheme
+		reqCopy.URL.Host = backend.URL.Host
+
+		resp, err := sendToBackend(ut.next, backend, reqCopy, ut.outlier)
+		if err != nil && requestCanceled(reqCopy, err) {
+			backend.ReportCanceled()
+			return nil, err
+		}
+		if err != nil {
+			backend.ReportFailure()
+			ut.log.Error("upgrade request failed",
+				slog.String("backendURL", backend.URL.String()),
+				sl.Err(err),
+			)
+			if !isConnectError(err) {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+
+		if backendStatus(resp) < 500 {
+			backend.ReportSuccess()
+		} else {
+			backend.ReportFailure()
+		}
+		if ut.sticky != nil && backend != pinned {
+			resp.Header.Add("Set-Cookie", ut.sticky.cookie(backend).String())
+		}
+		return resp, nil
+	}
+
+	if lastErr == nil {
+		lastErr = ErrNoFreeBackend
+	}
+	return nil, lastErr
+}
+
+// Открытые туннели, при остановке сервера они закрываются
+type tunnels struct {
+	cancels map[int64]context.CancelFunc
+	nextID  int64
+	closed  bool
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// Регистрирует туннель, его контекст отменяется при closeAll.
+// Возвращает false, если прокси уже останавливается
+func (t *tunnels) open(ctx context.Context) (context.Context, func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, nil, false
+	}
+	if t.cancels == nil {
+		t.cancels = make(map[int64]context.CancelFunc)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	id := t.nextID
+	t.nextID++
+	t.cancels[id] = cancel
+	t.wg.Add(1)
+
+	release := func() {
+		t.mu.Lock()
+		delete(t.cancels, id)
+		t.mu.Unlock()
+
+		cancel()
+		t.wg.Done()
+	}
+	return ctx, release, true
+}
+
+// Закрывает все туннели и ждет их завершения
+func (t *tunnels) closeAll() {
+	t.mu.Lock()
+	t.closed = true
+	for _, cancel := range t.cancels {
+		cancel()
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+}
+
+func (p *ReverseProxy) serveUpgrade(w http.ResponseWriter, r *http.Request) {
+	ctx, release, ok := p.tunnels.open(r.Context())
+	if !ok {
+		p.log.Warn("upgrade rejected", sl.Err(ErrTunnelsClosed))
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	p.log.Info("proxy upgrade",
+		slog.String("path", r.URL.Path),
+		slog.String("upgrade", r.Header.Get("Upgrade")),
+	)
+	p.upgradeProxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Закрывает открытые Upgrade туннели, вызывается при остановке сервера
+func (p *ReverseProxy) CloseTunnels() {
+	p.tunnels.closeAll()
+	p.log.Info("upgrade tunnels closed")
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgrade(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	// бэкенд переключается на протокол echo и возвращает полученные строки
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgrade(r) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		for {
+			line, err := brw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			brw.WriteString(line)
+			brw.Flush()
+		}
+	}))
+	t.Cleanup(echo.Close)
+
+	lb := balancer.NewRoundRobinBalancer(logger)
+	backendCfg := config.Backend{URL: echo.URL}
+	backend, err := balancer.NewBackend(backendCfg)
+	require.NoError(t, err)
+	lb.AddBackend(*backend)
+	backendRef := lb.GetAllBackends()[0]
+
+	proxy, err := NewReverseProxy(lb, config.Proxy{}, logger)
+	require.NoError(t, err)
+	front := httptest.NewServer(proxy)
+	t.Cleanup(front.Close)
+
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	_, err = io.WriteString(conn, "hello\n")
+	require.NoError(t, err)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", line)
+	assert.Equal(t, int64(1), backendRef.ActiveConnections())
+
+	proxy.CloseTunnels()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Eventually(t, func() bool {
+		return backendRef.ActiveConnections() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// после закрытия новые туннели не открываются
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	proxy.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
@@ -2,10 +2,14 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/proxyproto"
 	"loadbalancer/internal/lib/sl"
+	"loadbalancer/internal/lib/trustedproxy"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,45 +17,98 @@ import (
 	"time"
 )
 
+var (
+	ErrNoTrustedSources = errors.New("proxy protocol enabled without trusted_sources")
+)
+
+const (
+	defaultProxyHeaderTimeout = 5 * time.Second
+	defaultTLSPort            = 8443
+)
+
 type Server struct {
-	server *http.Server
-	log    *slog.Logger
+	server        *http.Server
+	proxyProtocol config.ProxyProtocol
+	tls           config.TLS
+	log           *slog.Logger
 }
 
 func New(handler http.Handler, cfg *config.HTTPServer, log *slog.Logger) *Server {
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      handler,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	// HTTP/2 без TLS принимается на том же порту, что и HTTP/1
+	if cfg.H2C {
+		server.Protocols = &http.Protocols{}
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+		// на HTTPS листенере HTTP/2 согласуется через ALPN
+		server.Protocols.SetHTTP2(true)
+	}
+
+	proxyProtocol := cfg.ProxyProtocol
+	if proxyProtocol.HeaderTimeout == 0 {
+		proxyProtocol.HeaderTimeout = defaultProxyHeaderTimeout
+	}
+
+	tlsCfg := cfg.TLS
+	if tlsCfg.Port == 0 {
+		tlsCfg.Port = defaultTLSPort
+	}
+	if tlsCfg.ReloadInterval == 0 {
+		tlsCfg.ReloadInterval = defaultCertReloadInterval
+	}
+
 	return &Server{
-		server: &http.Server{
-			Addr:         fmt.Sprintf(":%d", cfg.Port),
-			Handler:      handler,
-			ReadTimeout:  cfg.Timeout,
-			WriteTimeout: cfg.Timeout,
-			IdleTimeout:  cfg.IdleTimeout,
-		},
-		log: log,
+		server:        server,
+		proxyProtocol: proxyProtocol,
+		tls:           tlsCfg,
+		log:           log,
 	}
 }
 
 func (s *Server) Start() error {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	errCh := make(chan error)
+	errCh := make(chan error, 2)
 
-	s.log.Info("starting server", slog.String("address", s.server.Addr))
+	listener, tlsListener, err := s.listeners()
+	if err != nil {
+		s.log.Error("failed to listen", sl.Err(err))
+		return err
+	}
 
-	go func() {
-		errCh <- s.server.ListenAndServe()
-	}()
+	if listener != nil {
+		s.log.Info("starting server", slog.String("address", s.server.Addr))
+		go func() {
+			errCh <- s.server.Serve(listener)
+		}()
+	}
+	if tlsListener != nil {
+		s.log.Info("starting https server", slog.String("address", tlsListener.Addr().String()))
+		go func() {
+			// сертификаты берутся из TLSConfig.GetCertificate
+			errCh <- s.server.ServeTLS(tlsListener, "", "")
+		}()
+	}
 
 	select {
 	case err := <-errCh:
 		s.log.Error("server error", sl.Err(err))
+		// второй листенер и перечитывание сертификатов останавливаются вместе с сервером
+		if err := s.shutdown(); err != nil {
+			s.log.Error("server shutdown error", sl.Err(err))
+		}
 		return err
 	case <-stop:
 		s.log.Info("shutdown signal")
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := s.server.Shutdown(ctx); err != nil {
+		if err := s.shutdown(); err != nil {
 			s.log.Error("server shutdown error", sl.Err(err))
 			return err
 		}
@@ -60,3 +117,90 @@ func (s *Server) Start() error {
 	}
 	return nil
 }
+
+// Закрывает листенеры и ждет завершения активных запросов
+func (s *Server) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// HTTP и HTTPS листенеры. С обязательным сертификатом клиента HTTP листенер
+// не открывается, иначе через него можно обойти проверку сертификата
+func (s *Server) listeners() (listener, tlsListener net.Listener, err error) {
+	clientAuth := s.tls.ClientAuth != "" && s.tls.ClientAuth != ClientAuthNone
+	if clientAuth && !s.tls.Enabled {
+		return nil, nil, ErrClientAuthNoTLS
+	}
+
+	if s.tls.ClientAuth != ClientAuthRequire {
+		listener, err = s.listen(s.server.Addr)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		s.log.Info("client certificates are required, http listener is disabled")
+	}
+
+	if s.tls.Enabled {
+		tlsListener, err = s.listenTLS()
+		if err != nil {
+			if listener != nil {
+				listener.Close()
+			}
+			return nil, nil, fmt.Errorf("tls: %w", err)
+		}
+	}
+	return listener, tlsListener, nil
+}
+
+// С PROXY protocol адрес клиента берется из заголовка, который присылают
+// доверенные источники (L4 балансировщик перед сервером)
+func (s *Server) listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !s.proxyProtocol.Enabled {
+		return listener, nil
+	}
+	// без доверенных источников заголовок не разбирается ни на одном соединении,
+	// и за L4 балансировщиком все клиенты получили бы его адрес
+	if len(s.proxyProtocol.TrustedSources) == 0 {
+		listener.Close()
+		return nil, ErrNoTrustedSources
+	}
+
+	trusted, err := trustedproxy.New(s.proxyProtocol.TrustedSources)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	s.log.Info("proxy protocol enabled", slog.Any("trusted_sources", s.proxyProtocol.TrustedSources))
+	return proxyproto.NewListener(listener, trusted, s.proxyProtocol.HeaderTimeout), nil
+}
+
+// HTTPS листенер, сертификаты перечитываются при изменении файлов
+// до остановки сервера
+func (s *Server) listenTLS() (net.Listener, error) {
+	certs, err := newCertStore(s.tls.Certificates, s.log)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newTLSConfig(s.tls, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := s.listen(fmt.Sprintf(":%d", s.tls.Port))
+	if err != nil {
+		return nil, err
+	}
+	s.server.TLSConfig = tlsConfig
+
+	stop := make(chan struct{})
+	s.server.RegisterOnShutdown(func() { close(stop) })
+	go certs.watch(s.tls.ReloadInterval, stop)
+
+	return listener, nil
+}
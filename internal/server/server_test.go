@@ -0,0 +1,30 @@
+package server
+
+import (
+	"loadbalancer/internal/config"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	t.Run("PROXY protocol requires trusted sources", func(t *testing.T) {
+		s := New(http.NotFoundHandler(), &config.HTTPServer{ProxyProtocol: config.ProxyProtocol{Enabled: true}}, logger)
+		_, err := s.listen("127.0.0.1:0")
+		assert.ErrorIs(t, err, ErrNoTrustedSources)
+
+		s = New(http.NotFoundHandler(), &config.HTTPServer{ProxyProtocol: config.ProxyProtocol{
+			Enabled:        true,
+			TrustedSources: []string{"10.0.0.0/8"},
+		}}, logger)
+		listener, err := s.listen("127.0.0.1:0")
+		require.NoError(t, err)
+		listener.Close()
+	})
+}
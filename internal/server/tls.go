@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/sl"
+	"log/slog"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCertReloadInterval = 30 * time.Second
+)
+
+var (
+	ErrNoCertificates     = errors.New("tls enabled without certificates")
+	ErrUnknownTLSVersion  = errors.New("unknown tls version")
+	ErrUnknownCipherSuite = errors.New("unknown or insecure cipher suite")
+	ErrUnknownClientAuth  = errors.New("unknown client auth mode")
+	ErrNoClientCA         = errors.New("client auth requires client_ca_file")
+	ErrClientAuthNoTLS    = errors.New("client auth requires tls enabled")
+)
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	ClientAuthNone:     tls.NoClientCert,
+	ClientAuthOptional: tls.VerifyClientCertIfGiven,
+	ClientAuthRequire:  tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Настройки TLS листенера: сертификат выбирается по SNI из certs
+func newTLSConfig(cfg config.TLS, certs *certStore) (*tls.Config, error) {
+	if cfg.MinVersion == "" {
+		cfg.MinVersion = "1.2"
+	}
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTLSVersion, cfg.MinVersion)
+	}
+
+	// в TLS 1.3 набор шифров не настраивается, cipher_suites действуют для 1.2 и ниже
+	var cipherSuites []uint16
+	for _, name := range cfg.CipherSuites {
+		i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool {
+			return suite.Name == name
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCipherSuite, name)
+		}
+		cipherSuites = append(cipherSuites, tls.CipherSuites()[i].ID)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: certs.getCertificate,
+	}
+	if err := configureClientAuth(tlsConfig, cfg); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
+
+// Проверка сертификатов клиентов, subject проверенного сертификата
+// доступен в запросе через clientcert.Subject
+func configureClientAuth(tlsConfig *tls.Config, cfg config.TLS) error {
+	if cfg.ClientAuth == "" {
+		cfg.ClientAuth = ClientAuthNone
+	}
+	clientAuth, ok := clientAuthTypes[cfg.ClientAuth]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownClientAuth, cfg.ClientAuth)
+	}
+	if clientAuth == tls.NoClientCert {
+		return nil
+	}
+	if cfg.ClientCAFile == "" {
+		return ErrNoClientCA
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in client ca file %q", cfg.ClientCAFile)
+	}
+
+	tlsConfig.ClientAuth = clientAuth
+	tlsConfig.ClientCAs = pool
+	return nil
+}
+
+// Сертификаты, которые перечитываются с диска при изменении файлов
+type certStore struct {
+	files []config.Certificate
+	certs atomic.Pointer[[]tls.Certificate]
+	// время изменения файлов при последней загрузке
+	modTimes []time.Time
+	log      *slog.Logger
+}
+
+func newCertStore(files []config.Certificate, log *slog.Logger) (*certStore, error) {
+	if len(files) == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	store := &certStore{
+		files: files,
+		log:   log,
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (cs *certStore) load() error {
+	certs := make([]tls.Certificate, 0, len(cs.files))
+	modTimes := make([]time.Time, 0, 2*len(cs.files))
+	for _, file := range cs.files {
+		for _, path := range []string{file.CertFile, file.KeyFile} {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			modTimes = append(modTimes, info.ModTime())
+		}
+
+		cert, err := tls.LoadX509KeyPair(file.CertFile, file.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %q: %w", file.CertFile, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	cs.certs.Store(&certs)
+	cs.modTimes = modTimes
+	return nil
+}
+
+// Перечитывает сертификаты, если изменился хотя бы один файл.
+// При ошибке продолжают использоваться загруженные ранее сертификаты
+func (cs *certStore) reloadIfChanged() {
+	changed := false
+	i := 0
+	for _, file := range cs.files {
+		for _, path := range []string{file.CertFile, file.KeyFile} {
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().Equal(cs.modTimes[i]) {
+				changed = true
+			}
+			i++
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err := cs.load(); err != nil {
+		cs.log.Error("failed to reload certificates", sl.Err(err))
+		return
+	}
+	cs.log.Info("certificates reloaded")
+}
+
+// Проверяет файлы раз в interval до закрытия stop
+func (cs *certStore) watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cs.reloadIfChanged()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Первый сертификат, подходящий клиенту по SNI и поддерживаемым алгоритмам,
+// если такого нет - первый из списка
+func (cs *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := *cs.certs.Load()
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+	return &certs[0], nil
+}
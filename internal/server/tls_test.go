@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"loadbalancer/internal/config"
+	"loadbalancer/internal/lib/clientcert"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Самоподписанный сертификат для names, записанный в dir
+func writeCertificate(t *testing.T, dir, file string, names ...string) config.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	cert := config.Certificate{
+		CertFile: filepath.Join(dir, file+".crt"),
+		KeyFile:  filepath.Join(dir, file+".key"),
+	}
+	require.NoError(t, os.WriteFile(cert.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(cert.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return cert
+}
+
+func TestTLS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{}))
+
+	// TLS листенер, который завершает рукопожатие на каждом соединении
+	serve := func(t *testing.T, tlsConfig *tls.Config) string {
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+		require.NoError(t, err)
+		t.Cleanup(func() { listener.Close() })
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+		return listener.Addr().String()
+	}
+
+	// CommonName сертификата, который сервер выбрал для serverName.
+	// Без require, чтобы вызываться из assert.Eventually
+	handshake := func(addr, serverName string) (string, error) {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+	}
+	commonName := func(t *testing.T, addr, serverName string) string {
+		name, err := handshake(addr, serverName)
+		require.NoError(t, err)
+		return name
+	}
+
+	t.Run("Certificate is selected by SNI", func(t *testing.T) {
+		dir := t.TempDir()
+		certs, err := newCertStore([]config.Certificate{
+			writeCertificate(t, dir, "default", "default.example.com"),
+			writeCertificate(t, dir, "api", "api.example.com"),
+			writeCertificate(t, dir, "wildcard", "*.shop.example.com"),
+		}, logger)
+		require.NoError(t, err)
+
+		tlsConfig, err := newTLSConfig(config.TLS{}, certs)
+		require.NoError(t, err)
+		addr := serve(t, tlsConfig)
+
+		assert.Equal(t, "api.example.com", commonName(t, addr, "api.example.com"))
+		assert.Equal(t, "*.shop.example.com", commonName(t, addr, "eu.shop.example.com"))
+		assert.Equal(t, "default.example.com", commonName(t, addr, "unknown.example.com"))
+	})
+
+	t.Run("Certificates are reloaded when files change", func(t *testing.T) {
+		dir := t.TempDir()
+		cert := writeCertificate(t, dir, "site", "old.example.com")
+		certs, err := newCertStore([]config.Certificate{cert}, logger)
+		require.NoError(t, err)
+
+		tlsConfig, err := newTLSConfig(config.TLS{}, certs)
+		require.NoError(t, err)
+		addr := serve(t, tlsConfig)
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go certs.watch(10*time.Millisecond, stop)
+
+		assert.Equal(t, "old.example.com", commonName(t, addr, "old.example.com"))
+
+		writeCertificate(t, dir, "site", "new.example.com")
+		// время изменения может совпасть при быстрой записи
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(cert.CertFile, future, future))
+
+		assert.Eventually(t, func() bool {
+			name, err := handshake(addr, "new.example.com")
+			return err == nil && name == "new.example.com"
+		}, time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("Broken files keep previous certificates", func(t *testing.T) {
+		dir := t.TempDir()
+		cert := writeCertificate(t, dir, "site", "site.example.com")
+		certs, err := newCertStore([]config.Certificate{cert}, logger)
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(cert.CertFile, []byte("garbage"), 0o600))
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(cert.CertFile, future, future))
+		certs.reloadIfChanged()
+
+		current, err := certs.getCertificate(&tls.ClientHelloInfo{ServerName: "site.example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "site.example.com", current.Leaf.Subject.CommonName)
+	})
+
+	t.Run("Min version and cipher suites", func(t *testing.T) {
+		dir := t.TempDir()
+		certs, err := newCertStore([]config.Certificate{writeCertificate(t, dir, "site", "site.example.com")}, logger)
+		require.NoError(t, err)
+
+		tlsConfig, err := newTLSConfig(config.TLS{
+			MinVersion:   "1.3",
+			CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		}, certs)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+
+		addr := serve(t, tlsConfig)
+		_, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12})
+		assert.Error(t, err)
+
+		_, err = newTLSConfig(config.TLS{MinVersion: "2.0"}, certs)
+		assert.ErrorIs(t, err, ErrUnknownTLSVersion)
+		_, err = newTLSConfig(config.TLS{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, certs)
+		assert.ErrorIs(t, err, ErrUnknownCipherSuite)
+
+		_, err = newCertStore(nil, logger)
+		assert.ErrorIs(t, err, ErrNoCertificates)
+	})
+
+	t.Run("Client certificate verification", func(t *testing.T) {
+		dir := t.TempDir()
+		certs, err := newCertStore([]config.Certificate{writeCertificate(t, dir, "site", "site.example.com")}, logger)
+		require.NoError(t, err)
+
+		// самоподписанный сертификат клиента служит и своим CA
+		clientFiles := writeCertificate(t, dir, "client", "orders-service")
+		client, err := tls.LoadX509KeyPair(clientFiles.CertFile, clientFiles.KeyFile)
+		require.NoError(t, err)
+		stranger, err := tls.LoadX509KeyPair(writeCertificate(t, dir, "stranger", "stranger").CertFile, filepath.Join(dir, "stranger.key"))
+		require.NoError(t, err)
+
+		start := func(t *testing.T, clientAuth string) string {
+			tlsConfig, err := newTLSConfig(config.TLS{ClientAuth: clientAuth, ClientCAFile: clientFiles.CertFile}, certs)
+			require.NoError(t, err)
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject, _ := clientcert.Subject(r)
+				w.Write([]byte(subject))
+			}))
+			server.TLS = tlsConfig
+			server.StartTLS()
+			t.Cleanup(server.Close)
+			return server.URL
+		}
+
+		get := func(url string, cert *tls.Certificate) (string, error) {
+			tlsConfig := &tls.Config{InsecureSkipVerify: true}
+			if cert != nil {
+				tlsConfig.Certificates = []tls.Certificate{*cert}
+			}
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := httpClient.Get(url)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			return string(body), err
+		}
+
+		url := start(t, ClientAuthRequire)
+		subject, err := get(url, &client)
+		require.NoError(t, err)
+		assert.Equal(t, "CN=orders-service", subject)
+
+		_, err = get(url, nil)
+		assert.Error(t, err)
+		_, err = get(url, &stranger)
+		assert.Error(t, err)
+
+		url = start(t, ClientAuthOptional)
+		subject, err = get(url, nil)
+		require.NoError(t, err)
+		assert.Empty(t, subject)
+
+		_, err = newTLSConfig(config.TLS{ClientAuth: ClientAuthRequire}, certs)
+		assert.ErrorIs(t, err, ErrNoClientCA)
+		_, err = newTLSConfig(config.TLS{ClientAuth: "maybe"}, certs)
+		assert.ErrorIs(t, err, ErrUnknownClientAuth)
+	})
+
+	t.Run("Required client certificate disables http listener", func(t *testing.T) {
+		dir := t.TempDir()
+		free, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := free.Addr().(*net.TCPAddr).Port
+		free.Close()
+
+		cfg := &config.HTTPServer{TLS: config.TLS{
+			Enabled:      true,
+			Port:         port,
+			Certificates: []config.Certificate{writeCertificate(t, dir, "site", "site.example.com")},
+			ClientAuth:   ClientAuthRequire,
+			ClientCAFile: writeCertificate(t, dir, "client", "orders-service").CertFile,
+		}}
+		s := New(http.NotFoundHandler(), cfg, logger)
+		// Shutdown останавливает перечитывание сертификатов
+		t.Cleanup(func() { s.server.Shutdown(context.Background()) })
+
+		listener, tlsListener, err := s.listeners()
+		require.NoError(t, err)
+		t.Cleanup(func() { tlsListener.Close() })
+		assert.Nil(t, listener)
+		assert.NotNil(t, tlsListener)
+
+		s = New(http.NotFoundHandler(), &config.HTTPServer{TLS: config.TLS{ClientAuth: ClientAuthOptional}}, logger)
+		_, _, err = s.listeners()
+		assert.ErrorIs(t, err, ErrClientAuthNoTLS)
+	})
+}